@@ -22,11 +22,25 @@ import (
 	"context"
 	firebase "firebase.google.com/go/v4"
 	"github.com/getsentry/sentry-go"
+	"github.com/go-redis/redis/v8"
+	"github.com/hearky/server/pkg/admin"
+	"github.com/hearky/server/pkg/api"
+	"github.com/hearky/server/pkg/audit"
+	"github.com/hearky/server/pkg/auth"
+	"github.com/hearky/server/pkg/block"
+	"github.com/hearky/server/pkg/broker"
 	"github.com/hearky/server/pkg/config"
+	"github.com/hearky/server/pkg/database"
+	"github.com/hearky/server/pkg/deletion"
+	"github.com/hearky/server/pkg/domain"
+	"github.com/hearky/server/pkg/event"
+	"github.com/hearky/server/pkg/friend"
 	"github.com/hearky/server/pkg/invite"
 	"github.com/hearky/server/pkg/logger"
 	"github.com/hearky/server/pkg/meeting"
+	"github.com/hearky/server/pkg/turn"
 	"github.com/hearky/server/pkg/user"
+	"github.com/hearky/server/pkg/voice"
 	"github.com/hearky/server/pkg/web"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -53,27 +67,103 @@ func main() {
 	meetingRepository := meeting.NewRepository(db)
 	userRepository := user.NewRepository(db)
 	inviteRepository := invite.NewRepository(db)
+	err = invite.CreateIndexes(ctx, db)
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Fatal("failed to create invite indexes", zap.Error(err))
+	}
+	deletionJobRepository := deletion.NewRepository(db)
+	friendshipRepository := friend.NewRepository(db)
+	blockRepository := block.NewRepository(db)
+	auditRepository := audit.NewRepository(db)
+
+	transactor, err := database.NewTransactor(ctx, mgClient, cfg.MongoStandalone)
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Fatal("failed to create transactor", zap.Error(err))
+	}
+
+	// Connect to Redis, if configured, otherwise only deliver messages within this instance
+	var b domain.Broker
+	if cfg.RedisURL != "" {
+		rdOpts, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			zap.L().Fatal("failed to parse Redis URL", zap.Error(err))
+		}
+		rdClient := redis.NewClient(rdOpts)
+		ctx, ccl = context.WithTimeout(context.Background(), 10*time.Second)
+		defer ccl()
+		if err := rdClient.Ping(ctx).Err(); err != nil {
+			sentry.CaptureException(err)
+			zap.L().Fatal("failed to connect to Redis", zap.Error(err))
+		}
+		b = broker.NewRedis(rdClient)
+	} else {
+		b = broker.NewMemory()
+	}
+	defer b.Close()
 
-	meetingService := meeting.NewService(meetingRepository, inviteRepository, userRepository)
-	userService := user.NewService(userRepository, meetingRepository, inviteRepository)
-	inviteService := invite.NewService(inviteRepository, meetingRepository, userRepository)
+	eventBus, err := event.NewBus(b)
+	if err != nil {
+		zap.L().Fatal("failed to create event bus", zap.Error(err))
+	}
 
-	// Initialize firebase
+	// Initialize the authentication provider
+	var authenticator domain.Authenticator
+	var accountDeleter domain.AccountDeleter
 	ctx, ccl = context.WithTimeout(context.Background(), 10*time.Second)
 	defer ccl()
-	fbOpts := option.WithCredentialsFile("serviceAccountKey.json")
-	fbApp, err := firebase.NewApp(ctx, nil, fbOpts)
-	if err != nil {
-		sentry.CaptureException(err)
-		zap.L().Fatal("failed to initialize Firebase", zap.Error(err))
+	switch cfg.AuthProvider {
+	case "firebase":
+		fbOpts := option.WithCredentialsFile(cfg.FirebaseCredentials)
+		fbApp, err := firebase.NewApp(ctx, nil, fbOpts)
+		if err != nil {
+			sentry.CaptureException(err)
+			zap.L().Fatal("failed to initialize Firebase", zap.Error(err))
+		}
+		fbAuth, err := fbApp.Auth(context.Background())
+		if err != nil {
+			sentry.CaptureException(err)
+			zap.L().Fatal("failed to create FirebaseAuth client", zap.Error(err))
+		}
+		fb := auth.NewFirebase(fbAuth)
+		authenticator = fb
+		if cfg.DeleteAuthAccounts {
+			accountDeleter = fb
+		}
+	case "oidc":
+		authenticator, err = auth.NewOIDC(ctx, cfg.OIDCIssuer, cfg.OIDCJWKSURL, cfg.OIDCAudience)
+		if err != nil {
+			sentry.CaptureException(err)
+			zap.L().Fatal("failed to initialize OIDC", zap.Error(err))
+		}
+	case "static":
+		if !cfg.Dev {
+			zap.L().Fatal("static authentication is only allowed in dev mode")
+		}
+		authenticator = auth.NewStatic(cfg.StaticTokens)
+	default:
+		zap.L().Fatal("unknown authentication provider", zap.String("provider", cfg.AuthProvider))
 	}
-	fbAuth, err := fbApp.Auth(context.Background())
+
+	auditService := audit.NewService(auditRepository, userRepository)
+	inviteService := invite.NewService(inviteRepository, meetingRepository, userRepository, friendshipRepository, blockRepository, eventBus, transactor)
+	meetingService := meeting.NewService(meetingRepository, inviteRepository, userRepository, inviteService, auditService, eventBus, transactor)
+	userService := user.NewService(userRepository, meetingRepository, inviteRepository, deletionJobRepository, friendshipRepository, blockRepository, accountDeleter, auditService, eventBus)
+	friendService := friend.NewService(friendshipRepository, userRepository, blockRepository, eventBus)
+	adminService := admin.NewService(userRepository, meetingRepository, inviteRepository, auditRepository, meetingService, auditService, eventBus)
+	voiceService, err := voice.NewService(meetingRepository, blockRepository, eventBus, b)
 	if err != nil {
-		sentry.CaptureException(err)
-		zap.L().Fatal("failed to create FirebaseAuth client", zap.Error(err))
+		zap.L().Fatal("failed to create voice service", zap.Error(err))
 	}
+	blockService := block.NewService(blockRepository, userRepository, friendshipRepository, inviteRepository, voiceService, eventBus)
+	iceService := turn.NewService(meetingRepository, cfg.TurnSecret, cfg.TurnServers, cfg.StunServers, cfg.TurnTTL)
+
+	// Continue account deletions which were interrupted, and retry failed ones
+	go userService.ResumeDeletions()
 
 	// Initialize and start server
-	s := web.New(cfg.Dev, fbAuth, userService, meetingService, inviteService)
+	gateway := api.NewGateway(authenticator, userService, meetingRepository, voiceService, eventBus)
+	s := web.New(cfg.Dev, authenticator, userService, meetingService, inviteService, voiceService, iceService, friendService, blockService, adminService, gateway)
 	s.Start(cfg.WebAddress)
 }
@@ -6,6 +6,7 @@ require (
 	firebase.google.com/go/v4 v4.4.0
 	github.com/ansrivas/fiberprometheus/v2 v2.1.2
 	github.com/getsentry/sentry-go v0.10.0
+	github.com/go-redis/redis/v8 v8.8.0
 	github.com/gofiber/fiber/v2 v2.7.1
 	github.com/gofiber/websocket/v2 v2.0.3
 	github.com/google/uuid v1.2.0
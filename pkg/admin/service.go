@@ -0,0 +1,306 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package admin
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/hearky/server/pkg/domain"
+	"strings"
+	"time"
+)
+
+// maxAuditEntries is the maximum amount of audit entries returned at once
+const maxAuditEntries = 1000
+
+type service struct {
+	userRepo       domain.UserRepository
+	meetingRepo    domain.MeetingRepository
+	inviteRepo     domain.InviteRepository
+	auditRepo      domain.AuditRepository
+	meetingService domain.MeetingService
+	audit          domain.AuditService
+	events         domain.EventBus
+}
+
+func NewService(userRepository domain.UserRepository, meetingRepository domain.MeetingRepository, inviteRepository domain.InviteRepository, auditRepository domain.AuditRepository, meetingService domain.MeetingService, auditService domain.AuditService, eventBus domain.EventBus) domain.AdminService {
+	return &service{
+		userRepo:       userRepository,
+		meetingRepo:    meetingRepository,
+		inviteRepo:     inviteRepository,
+		auditRepo:      auditRepository,
+		meetingService: meetingService,
+		audit:          auditService,
+		events:         eventBus,
+	}
+}
+
+func (s *service) GetUser(id string, uid string) (*domain.User, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Check permissions
+	e, err := s.audit.Override(ctx, uid, domain.PermissionReadUsers, domain.AuditActionReadUser, id)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := s.userRepo.GetUserByID(ctx, id)
+	s.audit.Complete(e, err)
+	return u, err
+}
+
+func (s *service) GetUserByUsername(username string, uid string) (*domain.User, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Check permissions
+	e, err := s.audit.Override(ctx, uid, domain.PermissionReadUsers, domain.AuditActionReadUser, username)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := s.userRepo.GetUserByUsername(ctx, username)
+	s.audit.Complete(e, err)
+	return u, err
+}
+
+func (s *service) GetUserMeetings(id string, uid string) ([]*domain.Meeting, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Check permissions
+	e, err := s.audit.Override(ctx, uid, domain.PermissionReadMeetings, domain.AuditActionReadUserMeetings, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ms, err := s.meetingRepo.GetMeetingsByUser(ctx, id)
+	s.audit.Complete(e, err)
+	return ms, err
+}
+
+func (s *service) GetUserInvites(id string, uid string) (*domain.AdminUserInvites, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Check permissions
+	e, err := s.audit.Override(ctx, uid, domain.PermissionReadUsers, domain.AuditActionReadUserInvites, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch invites
+	is, err := s.userInvites(ctx, id)
+	s.audit.Complete(e, err)
+	return is, err
+}
+
+// userInvites returns all invites the user sent and received
+func (s *service) userInvites(ctx context.Context, id string) (*domain.AdminUserInvites, error) {
+	sent, err := s.inviteRepo.GetInvitesBySender(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	received, err := s.inviteRepo.GetInviteHistoryByReceiver(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.AdminUserInvites{Sent: sent, Received: received}, nil
+}
+
+func (s *service) ResetUsername(id string, dto *domain.ResetUsernameDto, uid string) (*domain.User, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Check permissions
+	e, err := s.audit.Override(ctx, uid, domain.PermissionManageUsers, domain.AuditActionResetUsername, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use the passed or a generated username, which has to be valid like the one chosen by the user
+	username := strings.TrimSpace(dto.Username)
+	if username == "" {
+		username = "user-" + strings.ReplaceAll(uuid.New().String(), "-", "")[:12]
+	}
+	if !domain.ValidUsername(username) {
+		s.audit.Complete(e, domain.ErrInvalidInput)
+		return nil, domain.ErrInvalidInput
+	}
+
+	var before string
+	u, err := s.modifyUser(ctx, id, func(u *domain.User) error {
+		// Check if the new username is free, again on every attempt
+		o, err := s.userRepo.GetUserByUsername(ctx, username)
+		if err != nil && err != domain.ErrNotFound {
+			return err
+		} else if err != domain.ErrNotFound && o.ID != u.ID {
+			return domain.ErrUsernameExists
+		}
+		before = u.Username
+		u.Username = username
+		return nil
+	})
+	if u != nil {
+		e.Details = &domain.AuditDetails{
+			Before: map[string]interface{}{"username": before},
+			After:  map[string]interface{}{"username": u.Username},
+		}
+	}
+	s.audit.Complete(e, err)
+	return u, err
+}
+
+func (s *service) UpdateUserUpgrade(id string, dto *domain.UpdateUserUpgradeDto, uid string) (*domain.User, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Check permissions
+	e, err := s.audit.Override(ctx, uid, domain.PermissionManageUsers, domain.AuditActionUpdateUserUpgrade, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var before domain.UserUpgrade
+	u, err := s.modifyUser(ctx, id, func(u *domain.User) error {
+		before = u.Upgrade
+		if dto.ConcurrentMeetings != nil {
+			if *dto.ConcurrentMeetings < 0 {
+				return domain.ErrInvalidInput
+			}
+			u.Upgrade.ConcurrentMeetings = *dto.ConcurrentMeetings
+		}
+		return nil
+	})
+	if u != nil {
+		e.Details = &domain.AuditDetails{
+			Before: map[string]interface{}{"upgrade": before},
+			After:  map[string]interface{}{"upgrade": u.Upgrade},
+		}
+	}
+	s.audit.Complete(e, err)
+	return u, err
+}
+
+func (s *service) DeleteMeeting(mid string, uid string) error {
+	// The meeting service records the override itself
+	return s.meetingService.DeleteMeeting(mid, uid)
+}
+
+func (s *service) UpdateMeetingUpgrade(mid string, dto *domain.UpdateMeetingUpgradeDto, uid string) (*domain.Meeting, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Check permissions
+	e, err := s.audit.Override(ctx, uid, domain.PermissionManageMeetings, domain.AuditActionUpdateMeetingUpgrade, mid)
+	if err != nil {
+		return nil, err
+	}
+
+	var m *domain.Meeting
+	var before domain.MeetingUpgrade
+	err = domain.RetryOnConflict(func() error {
+		// Fetch meeting
+		var err error
+		m, err = s.meetingRepo.GetMeetingByID(ctx, mid)
+		if err != nil {
+			return err
+		}
+		before = m.Upgrade
+
+		// Apply changes
+		if dto.Participants != nil {
+			if *dto.Participants < 0 {
+				return domain.ErrInvalidInput
+			}
+			m.Upgrade.Participants = *dto.Participants
+		}
+		if dto.ConcurrentInvites != nil {
+			if *dto.ConcurrentInvites < 0 {
+				return domain.ErrInvalidInput
+			}
+			m.Upgrade.ConcurrentInvites = *dto.ConcurrentInvites
+		}
+		return s.meetingRepo.SaveMeeting(ctx, m)
+	})
+	if err == nil {
+		e.Details = &domain.AuditDetails{
+			Before: map[string]interface{}{"upgrade": before},
+			After:  map[string]interface{}{"upgrade": m.Upgrade},
+		}
+	}
+	s.audit.Complete(e, err)
+	if err != nil {
+		return nil, err
+	}
+
+	s.events.Publish(&domain.Event{
+		Type:    domain.EventMeetingUpdate,
+		UserIDs: m.MemberIDs(),
+		Data:    m,
+	})
+	return m, nil
+}
+
+func (s *service) GetAuditLog(limit int64, uid string) ([]*domain.AuditEntry, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Check permissions
+	e, err := s.audit.Override(ctx, uid, domain.PermissionReadAuditLog, domain.AuditActionReadAuditLog, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 || limit > maxAuditEntries {
+		limit = maxAuditEntries
+	}
+	es, err := s.auditRepo.GetEntries(ctx, limit)
+	s.audit.Complete(e, err)
+	return es, err
+}
+
+// modifyUser fetches the user, applies fn and saves it, it is fetched again if it was changed in the meantime
+func (s *service) modifyUser(ctx context.Context, id string, fn func(u *domain.User) error) (*domain.User, error) {
+	var u *domain.User
+	err := domain.RetryOnConflict(func() error {
+		var err error
+		u, err = s.userRepo.GetUserByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := fn(u); err != nil {
+			return err
+		}
+		return s.userRepo.SaveUser(ctx, u)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
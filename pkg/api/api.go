@@ -19,34 +19,298 @@
 package api
 
 import (
-	"github.com/getsentry/sentry-go"
+	"encoding/json"
 	"github.com/gofiber/websocket/v2"
+	"github.com/hearky/server/pkg/domain"
 	"go.uber.org/zap"
+	"sync"
+	"time"
 )
 
+const (
+	OpHello          = "hello"
+	OpIdentify       = "identify"
+	OpReady          = "ready"
+	OpResume         = "resume"
+	OpResumed        = "resumed"
+	OpInvalidSession = "invalid_session"
+	OpHeartbeat      = "heartbeat"
+	OpHeartbeatAck   = "heartbeat_ack"
+	OpDispatch       = "dispatch"
+	OpError          = "error"
+)
+
+// Ops for exchanging WebRTC signaling data between participants of a meeting
+const (
+	OpRTCOffer        = "rtc_offer"
+	OpRTCAnswer       = "rtc_answer"
+	OpRTCIceCandidate = "rtc_ice_candidate"
+)
+
+// Ops for changing the voice state of the current user
+const (
+	OpVoiceJoin        = "voice_join"
+	OpVoiceLeave       = "voice_leave"
+	OpVoiceStateUpdate = "voice_state_update"
+)
+
+var (
+	// HeartbeatInterval is the interval in which clients have to send a heartbeat
+	HeartbeatInterval = 30 * time.Second
+	// HeartbeatTimeout is the time after which a connection without any heartbeat gets closed
+	HeartbeatTimeout = HeartbeatInterval + HeartbeatInterval/2
+	// IdentifyTimeout is the time after the hello in which a client has to identify or resume,
+	// heartbeats do not extend it
+	IdentifyTimeout = 10 * time.Second
+	// ResumeGracePeriod is the time a disconnected session can be resumed in
+	ResumeGracePeriod = 2 * time.Minute
+	// ReplayBufferSize is the maximum amount of events kept per session for replaying them on resume
+	ReplayBufferSize = 256
+)
+
+// WSMessage is the envelope of every message sent over the gateway
 type WSMessage struct {
-	OP   string      `json:"op"`
-	Data interface{} `json:"d"`
+	OP   string          `json:"op"`
+	Type string          `json:"t,omitempty"`
+	Seq  uint64          `json:"s,omitempty"`
+	Data json.RawMessage `json:"d,omitempty"`
 }
 
 type Error struct {
-	Code string
+	Code string `json:"code"`
+}
+
+var (
+	ErrInvalidPayload    = Error{Code: "invalid-payload"}
+	ErrUnknownOp         = Error{Code: "unknown-op"}
+	ErrNotIdentified     = Error{Code: "not-identified"}
+	ErrAlreadyIdentified = Error{Code: "already-identified"}
+	ErrInvalidToken      = Error{Code: "invalid-token"}
+	ErrUnknownUser       = Error{Code: "unknown-user"}
+	ErrForbidden         = Error{Code: "forbidden"}
+	ErrNotFound          = Error{Code: "not-found"}
+	ErrInternal          = Error{Code: "internal"}
+)
+
+// Close codes sent to the client before the server terminates a connection
+const (
+	CloseNotIdentified        = 4003
+	CloseAuthenticationFailed = 4004
+	CloseAlreadyIdentified    = 4005
+	CloseSessionReplaced      = 4006
+)
+
+type handler func(g *Gateway, s *Session, m *WSMessage)
+
+// handlers maps every op a client is allowed to send to its handler
+var handlers = map[string]handler{
+	OpIdentify:  identify,
+	OpResume:    resume,
+	OpHeartbeat: heartbeat,
+
+	OpRTCOffer:        rtcOffer,
+	OpRTCAnswer:       rtcAnswer,
+	OpRTCIceCandidate: rtcIceCandidate,
+
+	OpVoiceJoin:        voiceJoin,
+	OpVoiceLeave:       voiceLeave,
+	OpVoiceStateUpdate: voiceStateUpdate,
+}
+
+// unauthenticated contains all ops a client may send before it identified itself
+var unauthenticated = map[string]bool{
+	OpIdentify:  true,
+	OpResume:    true,
+	OpHeartbeat: true,
+}
+
+// Gateway handles persistent WebSocket connections of clients
+type Gateway struct {
+	auth         domain.Authenticator
+	userService  domain.UserService
+	meetingRepo  domain.MeetingRepository
+	voiceService domain.VoiceService
+	events       domain.EventBus
+
+	mu       sync.RWMutex
+	sessions map[string]*Session
+	users    map[string]map[*Session]struct{}
+}
+
+func NewGateway(auth domain.Authenticator, userService domain.UserService, meetingRepository domain.MeetingRepository, voiceService domain.VoiceService, eventBus domain.EventBus) *Gateway {
+	g := &Gateway{
+		auth:         auth,
+		userService:  userService,
+		meetingRepo:  meetingRepository,
+		voiceService: voiceService,
+		events:       eventBus,
+		sessions:     make(map[string]*Session),
+		users:        make(map[string]map[*Session]struct{}),
+	}
+	eventBus.Subscribe(g.dispatch)
+	go g.sweep()
+	return g
+}
+
+// Handle serves a single WebSocket connection until it gets closed
+func (g *Gateway) Handle(c *websocket.Conn) {
+	s := newSession(c)
+	defer s.disconnect()
+
+	s.Send(OpHello, &Hello{HeartbeatInterval: HeartbeatInterval.Milliseconds()})
+	s.awaitIdentify()
+	t := time.AfterFunc(IdentifyTimeout, func() {
+		if !s.Identified() {
+			s.Close(CloseNotIdentified, ErrNotIdentified.Code)
+		}
+	})
+	defer t.Stop()
+
+	for {
+		var m WSMessage
+		if err := c.ReadJSON(&m); err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				// The client ended the session on purpose, it can not be resumed
+				g.end(s)
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway) {
+				zap.L().Debug("gateway connection closed", zap.String("session", s.ID), zap.Error(err))
+			}
+			return
+		}
+		g.HandleMessage(s, &m)
+		if s.isClosed() {
+			return
+		}
+	}
 }
 
-var ErrInvalidPayload = Error{Code: "invalid-payload"}
+// HandleMessage routes a message to the handler of its op
+func (g *Gateway) HandleMessage(s *Session, m *WSMessage) {
+	h, ok := handlers[m.OP]
+	if !ok {
+		s.SendError(ErrUnknownOp)
+		return
+	}
+	if !unauthenticated[m.OP] && !s.Identified() {
+		s.Close(CloseNotIdentified, ErrNotIdentified.Code)
+		return
+	}
+	h(g, s, m)
+}
+
+// register adds an identified session to the gateway
+func (g *Gateway) register(s *Session) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.registerLocked(s)
+}
+
+func (g *Gateway) registerLocked(s *Session) {
+	g.sessions[s.ID] = s
+	us, ok := g.users[s.UserID]
+	if !ok {
+		us = make(map[*Session]struct{})
+		g.users[s.UserID] = us
+	}
+	us[s] = struct{}{}
+}
+
+// end removes a session from the gateway, afterwards it can not be resumed anymore
+func (g *Gateway) end(s *Session) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.endLocked(s)
+}
+
+func (g *Gateway) endLocked(s *Session) {
+	if g.sessions[s.ID] != s {
+		return
+	}
+	g.unregisterLocked(s)
+	go g.voiceService.Disconnect(s.ID)
+}
+
+// unregisterLocked removes a session from the registry without ending it, e.g. when it gets taken over
+func (g *Gateway) unregisterLocked(s *Session) {
+	if g.sessions[s.ID] == s {
+		delete(g.sessions, s.ID)
+	}
+	us, ok := g.users[s.UserID]
+	if !ok {
+		return
+	}
+	delete(us, s)
+	if len(us) == 0 {
+		delete(g.users, s.UserID)
+	}
+}
+
+// takeOver moves the state of the session with the given id to s, which replays all events after seq.
+// It returns false if the session does not exist anymore or the missed events are not buffered.
+func (g *Gateway) takeOver(s *Session, id string, uid string, seq uint64) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	old, ok := g.sessions[id]
+	if !ok || old.UserID != uid {
+		return false
+	}
+	if !s.adopt(old, seq) {
+		g.endLocked(old)
+		return false
+	}
+	g.unregisterLocked(old)
+	g.registerLocked(s)
+	return true
+}
+
+// dispatch sends an event to every session of the affected users
+func (g *Gateway) dispatch(e *domain.Event) {
+	d, err := json.Marshal(e.Data)
+	if err != nil {
+		zap.L().Error("could not encode event", zap.String("type", e.Type), zap.Error(err))
+		return
+	}
+
+	// Dispatching only queues the event, so the registry stays locked and no session can be taken over meanwhile
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	for _, uid := range e.UserIDs {
+		for s := range g.users[uid] {
+			s.Dispatch(e.Type, d)
+		}
+	}
+}
+
+// sweep periodically removes all sessions which can not be resumed anymore
+func (g *Gateway) sweep() {
+	t := time.NewTicker(ResumeGracePeriod / 4)
+	defer t.Stop()
+	for range t.C {
+		g.mu.Lock()
+		for _, s := range g.sessions {
+			if s.expired() {
+				g.endLocked(s)
+			}
+		}
+		g.mu.Unlock()
+	}
+}
 
-func HandleMessage(c *websocket.Conn, m *WSMessage) {
-	switch m.OP {
-	case "login":
-		login(c, m)
-		break
+// domainError converts an error returned by a service into a gateway error
+func domainError(err error) Error {
+	switch err {
+	case domain.ErrNotFound:
+		return ErrNotFound
+	case domain.ErrForbidden:
+		return ErrForbidden
 	}
+	return ErrInternal
 }
 
-func sendError(c *websocket.Conn, err Error) {
-	if err := c.WriteJSON(err); err != nil {
-		sentry.CaptureException(err)
-		zap.L().Error("could not send response", zap.Error(err))
+// decode parses the data of a message into v
+func decode(m *WSMessage, v interface{}) bool {
+	if len(m.Data) == 0 {
+		return false
 	}
-	return
+	return json.Unmarshal(m.Data, v) == nil
 }
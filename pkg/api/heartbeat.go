@@ -18,22 +18,10 @@
 
 package api
 
-import (
-	"github.com/gofiber/websocket/v2"
-	"go.uber.org/zap"
-)
-
-type LoginRequest struct {
-	Identifier string `json:"identifier"`
-	Password   string `json:"password"`
-}
-
-func login(c *websocket.Conn, m *WSMessage) {
-	zap.L().Info("mes", zap.Any("message", m.Data))
-	req, ok := m.Data.(*LoginRequest)
-	if !ok {
-		sendError(c, ErrInvalidPayload)
-		return
+// heartbeat acknowledges a heartbeat, only identified sessions get their deadline extended
+func heartbeat(_ *Gateway, s *Session, _ *WSMessage) {
+	if s.Identified() {
+		s.extendDeadline()
 	}
-	zap.L().Info("Login Request", zap.Any("req", req))
+	s.Send(OpHeartbeatAck, nil)
 }
@@ -0,0 +1,114 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"context"
+	"github.com/hearky/server/pkg/domain"
+	"time"
+)
+
+type Hello struct {
+	HeartbeatInterval int64 `json:"heartbeat_interval"`
+}
+
+type IdentifyRequest struct {
+	Token string `json:"token"`
+}
+
+type ResumeRequest struct {
+	Token     string `json:"token"`
+	SessionID string `json:"session_id"`
+	Seq       uint64 `json:"seq"`
+}
+
+type Ready struct {
+	SessionID string       `json:"session_id"`
+	User      *domain.User `json:"user"`
+}
+
+func identify(g *Gateway, s *Session, m *WSMessage) {
+	var req IdentifyRequest
+	if !decode(m, &req) || req.Token == "" {
+		s.SendError(ErrInvalidPayload)
+		return
+	}
+	if s.Identified() {
+		s.Close(CloseAlreadyIdentified, ErrAlreadyIdentified.Code)
+		return
+	}
+
+	uid, ok := g.authenticate(s, req.Token)
+	if !ok {
+		return
+	}
+
+	// Check if the account exists
+	u, err := g.userService.GetUser(uid, uid)
+	if err == domain.ErrNotFound {
+		s.Close(CloseAuthenticationFailed, ErrUnknownUser.Code)
+		return
+	} else if err != nil {
+		s.SendError(ErrInternal)
+		return
+	}
+
+	s.identify(u.ID)
+	g.register(s)
+	s.extendDeadline()
+	s.Send(OpReady, &Ready{SessionID: s.ID, User: u})
+}
+
+func resume(g *Gateway, s *Session, m *WSMessage) {
+	var req ResumeRequest
+	if !decode(m, &req) || req.Token == "" || req.SessionID == "" {
+		s.SendError(ErrInvalidPayload)
+		return
+	}
+	if s.Identified() {
+		s.Close(CloseAlreadyIdentified, ErrAlreadyIdentified.Code)
+		return
+	}
+
+	uid, ok := g.authenticate(s, req.Token)
+	if !ok {
+		return
+	}
+
+	// The client has to identify again, if the session can not be resumed
+	if !g.takeOver(s, req.SessionID, uid, req.Seq) {
+		s.Send(OpInvalidSession, nil)
+		return
+	}
+	s.extendDeadline()
+	s.Send(OpResumed, nil)
+}
+
+// authenticate verifies the token and returns the id of its user,
+// if the token is invalid the connection gets closed
+func (g *Gateway) authenticate(s *Session, token string) (string, bool) {
+	ctx, ccl := context.WithTimeout(context.Background(), 5*time.Second)
+	defer ccl()
+	uid, err := g.auth.Authenticate(ctx, token)
+	if err != nil {
+		s.Close(CloseAuthenticationFailed, ErrInvalidToken.Code)
+		return "", false
+	}
+	return uid, true
+}
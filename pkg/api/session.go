@@ -0,0 +1,252 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/getsentry/sentry-go"
+	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// writeTimeout is the time after which a blocked write to a client gets aborted
+const writeTimeout = 10 * time.Second
+
+// queueSize is the amount of messages which can wait for being written to a client,
+// it fits a full replay and the messages sent in the meantime
+var queueSize = 2 * ReplayBufferSize
+
+// conn is the part of a WebSocket connection a session writes to
+type conn interface {
+	WriteJSON(v interface{}) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetReadDeadline(t time.Time) error
+	Close() error
+}
+
+// Session holds the state of a gateway session, which can outlive its connection
+// for the ResumeGracePeriod
+type Session struct {
+	ID     string
+	UserID string
+
+	mu             sync.Mutex
+	conn           conn
+	out            chan *WSMessage
+	done           chan struct{}
+	closeMsg       []byte
+	closed         bool
+	disconnectedAt time.Time
+	seq            uint64
+	buffer         []*WSMessage
+}
+
+func newSession(c conn) *Session {
+	s := &Session{
+		conn: c,
+		out:  make(chan *WSMessage, queueSize),
+		done: make(chan struct{}),
+	}
+	go s.write()
+	return s
+}
+
+// Identified returns true if the session completed the identify handshake
+func (s *Session) Identified() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.UserID != ""
+}
+
+// identify binds the session to the given user and assigns it a new id
+func (s *Session) identify(uid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ID = uuid.New().String()
+	s.UserID = uid
+}
+
+// adopt takes over the state of a previous session and replays all events after seq.
+// It returns false if the previous session expired or not all missed events are buffered anymore.
+func (s *Session) adopt(old *Session, seq uint64) bool {
+	old.mu.Lock()
+	defer old.mu.Unlock()
+	if old.expiredLocked() || seq > old.seq || old.seq-seq > uint64(len(old.buffer)) {
+		return false
+	}
+
+	// Terminate the previous connection, if the client did not notice it is dead yet
+	old.closeLocked(CloseSessionReplaced, "session-replaced")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ID = old.ID
+	s.UserID = old.UserID
+	s.seq = old.seq
+	s.buffer = append([]*WSMessage(nil), old.buffer...)
+	for _, m := range s.buffer[uint64(len(s.buffer))-(old.seq-seq):] {
+		s.enqueueLocked(m)
+	}
+	return true
+}
+
+// Send writes a message with the given op and data to the client
+func (s *Session) Send(op string, d interface{}) {
+	m := &WSMessage{OP: op}
+	if d != nil {
+		raw, err := json.Marshal(d)
+		if err != nil {
+			sentry.CaptureException(err)
+			zap.L().Error("could not encode gateway message", zap.String("op", op), zap.Error(err))
+			return
+		}
+		m.Data = raw
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enqueueLocked(m)
+}
+
+// Dispatch writes an event of the given type to the client and keeps it for a possible replay
+func (s *Session) Dispatch(t string, d json.RawMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	m := &WSMessage{OP: OpDispatch, Type: t, Seq: s.seq, Data: d}
+	s.buffer = append(s.buffer, m)
+	if len(s.buffer) > ReplayBufferSize {
+		s.buffer = s.buffer[len(s.buffer)-ReplayBufferSize:]
+	}
+	s.enqueueLocked(m)
+}
+
+// SendError writes an error message to the client
+func (s *Session) SendError(err Error) {
+	s.Send(OpError, err)
+}
+
+// Close sends a close frame with the given code after all queued messages and terminates the connection
+func (s *Session) Close(code int, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked(code, reason)
+}
+
+func (s *Session) closeLocked(code int, reason string) {
+	if s.closed {
+		return
+	}
+	s.closeMsg = websocket.FormatCloseMessage(code, reason)
+	s.markClosedLocked()
+}
+
+// abortLocked terminates the connection immediately and drops all queued messages
+func (s *Session) abortLocked() {
+	s.markClosedLocked()
+	_ = s.conn.Close()
+}
+
+func (s *Session) markClosedLocked() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.disconnectedAt = time.Now()
+	close(s.out)
+}
+
+// enqueueLocked queues a message for the writer, a client which can not keep up gets disconnected
+// and has to resume its session
+func (s *Session) enqueueLocked(m *WSMessage) {
+	if s.closed {
+		return
+	}
+	select {
+	case s.out <- m:
+	default:
+		zap.L().Debug("gateway client is too slow", zap.String("session", s.ID))
+		s.abortLocked()
+	}
+}
+
+// write sends all queued messages to the client until the session gets closed,
+// the first failed write terminates the connection
+func (s *Session) write() {
+	defer close(s.done)
+	for m := range s.out {
+		_ = s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := s.conn.WriteJSON(m); err != nil {
+			zap.L().Debug("could not send gateway message", zap.String("op", m.OP), zap.Error(err))
+			s.mu.Lock()
+			s.abortLocked()
+			s.mu.Unlock()
+			return
+		}
+	}
+
+	s.mu.Lock()
+	closeMsg := s.closeMsg
+	s.mu.Unlock()
+	if closeMsg != nil {
+		_ = s.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+	}
+	_ = s.conn.Close()
+}
+
+// isClosed returns true if the connection of the session is closed
+func (s *Session) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// expired returns true if the session is disconnected for longer than the ResumeGracePeriod
+func (s *Session) expired() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.expiredLocked()
+}
+
+func (s *Session) expiredLocked() bool {
+	return s.closed && time.Since(s.disconnectedAt) > ResumeGracePeriod
+}
+
+// awaitIdentify gives the client the IdentifyTimeout to identify itself
+func (s *Session) awaitIdentify() {
+	_ = s.conn.SetReadDeadline(time.Now().Add(IdentifyTimeout))
+}
+
+// extendDeadline resets the time the client has until it must send its next heartbeat
+func (s *Session) extendDeadline() {
+	_ = s.conn.SetReadDeadline(time.Now().Add(HeartbeatTimeout))
+}
+
+// disconnect marks the session as closed once the connection handler returns
+// and waits for the writer, the connection must not be used afterwards
+func (s *Session) disconnect() {
+	s.mu.Lock()
+	s.markClosedLocked()
+	s.mu.Unlock()
+	<-s.done
+}
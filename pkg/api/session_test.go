@@ -0,0 +1,203 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/hearky/server/pkg/domain"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConn records all messages written by a session
+type fakeConn struct {
+	mu       sync.Mutex
+	messages []*WSMessage
+	closed   bool
+}
+
+func (c *fakeConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, v.(*WSMessage))
+	return nil
+}
+
+func (c *fakeConn) WriteControl(int, []byte, time.Time) error { return nil }
+func (c *fakeConn) SetWriteDeadline(time.Time) error          { return nil }
+func (c *fakeConn) SetReadDeadline(time.Time) error           { return nil }
+
+func (c *fakeConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+// dispatched returns the sequence numbers of all dispatched events written to the connection
+func (c *fakeConn) dispatched() []uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var seqs []uint64
+	for _, m := range c.messages {
+		if m.OP == OpDispatch {
+			seqs = append(seqs, m.Seq)
+		}
+	}
+	return seqs
+}
+
+// newIdentifiedSession creates a session of the user which received n events
+func newIdentifiedSession(uid string, n int) (*Session, *fakeConn) {
+	c := &fakeConn{}
+	s := newSession(c)
+	s.identify(uid)
+	for i := 0; i < n; i++ {
+		s.Dispatch("test", json.RawMessage(`{}`))
+	}
+	return s, c
+}
+
+// flush waits until all queued messages of the session are written
+func flush(s *Session) {
+	s.disconnect()
+}
+
+func equalSeqs(a []uint64, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSessionAdopt(t *testing.T) {
+	tests := []struct {
+		name   string
+		events int
+		seq    uint64
+		ok     bool
+		replay []uint64
+	}{
+		{name: "nothing missed", events: 3, seq: 3, ok: true},
+		{name: "replay after seq", events: 3, seq: 1, ok: true, replay: []uint64{2, 3}},
+		{name: "replay everything", events: 3, seq: 0, ok: true, replay: []uint64{1, 2, 3}},
+		{name: "seq from the future", events: 3, seq: 4},
+		{name: "events not buffered anymore", events: ReplayBufferSize + 2, seq: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, oldConn := newIdentifiedSession("user", tt.events)
+			s, c := newIdentifiedSession("", 0)
+
+			if ok := s.adopt(old, tt.seq); ok != tt.ok {
+				t.Fatalf("adopt() = %v, want %v", ok, tt.ok)
+			}
+			flush(s)
+			if !tt.ok {
+				if len(c.dispatched()) != 0 {
+					t.Errorf("replayed %v, want nothing", c.dispatched())
+				}
+				return
+			}
+
+			if s.ID != old.ID || s.UserID != old.UserID {
+				t.Errorf("adopted session %s of %s, want %s of %s", s.ID, s.UserID, old.ID, old.UserID)
+			}
+			if !equalSeqs(c.dispatched(), tt.replay) {
+				t.Errorf("replayed %v, want %v", c.dispatched(), tt.replay)
+			}
+			flush(old)
+			if !oldConn.closed {
+				t.Error("previous connection is still open")
+			}
+		})
+	}
+}
+
+func TestSessionAdoptContinuesSequence(t *testing.T) {
+	old, _ := newIdentifiedSession("user", 2)
+	s, c := newIdentifiedSession("", 0)
+	if !s.adopt(old, 2) {
+		t.Fatal("adopt() = false")
+	}
+
+	// Events after the takeover must neither reuse sequence numbers nor change the buffer of the old session
+	s.Dispatch("test", json.RawMessage(`{}`))
+	flush(s)
+	if !equalSeqs(c.dispatched(), []uint64{3}) {
+		t.Errorf("dispatched %v, want [3]", c.dispatched())
+	}
+	if len(old.buffer) != 2 {
+		t.Errorf("old session buffers %d events, want 2", len(old.buffer))
+	}
+}
+
+func newTestGateway() *Gateway {
+	return &Gateway{
+		sessions: make(map[string]*Session),
+		users:    make(map[string]map[*Session]struct{}),
+	}
+}
+
+func TestGatewayTakeOver(t *testing.T) {
+	tests := []struct {
+		name string
+		uid  string
+		id   func(old *Session) string
+		ok   bool
+	}{
+		{name: "same user", uid: "user", id: func(old *Session) string { return old.ID }, ok: true},
+		{name: "other user", uid: "other", id: func(old *Session) string { return old.ID }},
+		{name: "unknown session", uid: "user", id: func(*Session) string { return "unknown" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGateway()
+			old, _ := newIdentifiedSession("user", 1)
+			g.register(old)
+			s, c := newIdentifiedSession("", 0)
+
+			if ok := g.takeOver(s, tt.id(old), tt.uid, 0); ok != tt.ok {
+				t.Fatalf("takeOver() = %v, want %v", ok, tt.ok)
+			}
+			if !tt.ok {
+				if g.sessions[old.ID] != old || s.UserID != "" {
+					t.Error("failed takeover changed the sessions")
+				}
+				return
+			}
+
+			// Events dispatched after the takeover reach the new session
+			g.dispatch(&domain.Event{Type: "test", UserIDs: []string{"user"}, Data: struct{}{}})
+			flush(s)
+			if g.sessions[old.ID] != s {
+				t.Error("takeover did not register the new session")
+			}
+			if !equalSeqs(c.dispatched(), []uint64{1, 2}) {
+				t.Errorf("dispatched %v, want [1 2]", c.dispatched())
+			}
+		})
+	}
+}
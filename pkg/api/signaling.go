@@ -0,0 +1,117 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"context"
+	"github.com/hearky/server/pkg/domain"
+	"time"
+)
+
+// SessionDescription is a WebRTC SDP offer or answer
+type SessionDescription struct {
+	Type string `json:"type"`
+	SDP  string `json:"sdp"`
+}
+
+// IceCandidate is a WebRTC ICE candidate
+type IceCandidate struct {
+	Candidate        string  `json:"candidate"`
+	SDPMid           *string `json:"sdpMid,omitempty"`
+	SDPMLineIndex    *uint16 `json:"sdpMLineIndex,omitempty"`
+	UsernameFragment *string `json:"usernameFragment,omitempty"`
+}
+
+// SignalRequest is sent by a client to relay signaling data to another participant of a meeting
+type SignalRequest struct {
+	MeetingID   string              `json:"meeting_id"`
+	TargetID    string              `json:"target_id"`
+	Description *SessionDescription `json:"description,omitempty"`
+	Candidate   *IceCandidate       `json:"candidate,omitempty"`
+}
+
+// Signal is dispatched to the target of a SignalRequest
+type Signal struct {
+	MeetingID   string              `json:"meeting_id"`
+	SenderID    string              `json:"sender_id"`
+	Description *SessionDescription `json:"description,omitempty"`
+	Candidate   *IceCandidate       `json:"candidate,omitempty"`
+}
+
+func rtcOffer(g *Gateway, s *Session, m *WSMessage) {
+	var req SignalRequest
+	if !decode(m, &req) || req.Description == nil || req.Description.Type != "offer" {
+		s.SendError(ErrInvalidPayload)
+		return
+	}
+	g.relaySignal(s, domain.EventRTCOffer, &req)
+}
+
+func rtcAnswer(g *Gateway, s *Session, m *WSMessage) {
+	var req SignalRequest
+	if !decode(m, &req) || req.Description == nil || req.Description.Type != "answer" {
+		s.SendError(ErrInvalidPayload)
+		return
+	}
+	g.relaySignal(s, domain.EventRTCAnswer, &req)
+}
+
+func rtcIceCandidate(g *Gateway, s *Session, m *WSMessage) {
+	var req SignalRequest
+	if !decode(m, &req) || req.Candidate == nil {
+		s.SendError(ErrInvalidPayload)
+		return
+	}
+	g.relaySignal(s, domain.EventRTCIceCandidate, &req)
+}
+
+// relaySignal sends the signaling data to the target, if both are participants of the meeting.
+// Unlike reading the meeting, relaying is never allowed to moderators or admins outside of it.
+func (g *Gateway) relaySignal(s *Session, t string, req *SignalRequest) {
+	if req.MeetingID == "" || req.TargetID == "" || req.TargetID == s.UserID {
+		s.SendError(ErrInvalidPayload)
+		return
+	}
+
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 5*time.Second)
+	defer ccl()
+
+	// Check if sender and target are participants
+	mt, err := g.meetingRepo.GetMeetingByID(ctx, req.MeetingID)
+	if err != nil {
+		s.SendError(domainError(err))
+		return
+	}
+	if !mt.IsParticipant(s.UserID) || !mt.IsParticipant(req.TargetID) {
+		s.SendError(ErrForbidden)
+		return
+	}
+
+	g.events.Publish(&domain.Event{
+		Type:    t,
+		UserIDs: []string{req.TargetID},
+		Data: &Signal{
+			MeetingID:   mt.ID,
+			SenderID:    s.UserID,
+			Description: req.Description,
+			Candidate:   req.Candidate,
+		},
+	})
+}
@@ -0,0 +1,99 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"context"
+	"github.com/hearky/server/pkg/domain"
+	"testing"
+)
+
+type fakeMeetingRepository struct {
+	domain.MeetingRepository
+	meeting *domain.Meeting
+}
+
+func (r *fakeMeetingRepository) GetMeetingByID(_ context.Context, id string) (*domain.Meeting, error) {
+	if r.meeting.ID != id {
+		return nil, domain.ErrNotFound
+	}
+	m := *r.meeting
+	return &m, nil
+}
+
+// fakeEventBus records all published events
+type fakeEventBus struct {
+	events []*domain.Event
+}
+
+func (b *fakeEventBus) Publish(e *domain.Event)       { b.events = append(b.events, e) }
+func (b *fakeEventBus) Subscribe(func(*domain.Event)) {}
+
+func TestRelaySignal(t *testing.T) {
+	tests := []struct {
+		name    string
+		sender  string
+		target  string
+		meeting string
+		err     string
+	}{
+		{name: "participants", sender: "owner", target: "user", meeting: "meeting"},
+		{name: "sender is no participant", sender: "moderator", target: "user", meeting: "meeting", err: ErrForbidden.Code},
+		{name: "target is no participant", sender: "owner", target: "moderator", meeting: "meeting", err: ErrForbidden.Code},
+		{name: "unknown meeting", sender: "owner", target: "user", meeting: "other", err: ErrNotFound.Code},
+		{name: "signal to oneself", sender: "owner", target: "owner", meeting: "meeting", err: ErrInvalidPayload.Code},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := &fakeEventBus{}
+			g := newTestGateway()
+			g.events = events
+			g.meetingRepo = &fakeMeetingRepository{meeting: &domain.Meeting{
+				ID:           "meeting",
+				OwnerID:      "owner",
+				Participants: []string{"user"},
+			}}
+			s, c := newIdentifiedSession(tt.sender, 0)
+
+			g.relaySignal(s, domain.EventRTCOffer, &SignalRequest{
+				MeetingID:   tt.meeting,
+				TargetID:    tt.target,
+				Description: &SessionDescription{Type: "offer"},
+			})
+			flush(s)
+
+			var errs []string
+			for _, m := range c.messages {
+				var e Error
+				if m.OP == OpError && decode(m, &e) {
+					errs = append(errs, e.Code)
+				}
+			}
+			if tt.err != "" {
+				if len(errs) != 1 || errs[0] != tt.err || len(events.events) != 0 {
+					t.Errorf("got errors %v and %d events, want error %s", errs, len(events.events), tt.err)
+				}
+				return
+			}
+			if len(errs) != 0 || len(events.events) != 1 || events.events[0].UserIDs[0] != tt.target {
+				t.Errorf("got errors %v and events %v, want a signal to %s", errs, events.events, tt.target)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import "github.com/hearky/server/pkg/domain"
+
+type VoiceJoinRequest struct {
+	MeetingID string `json:"meeting_id"`
+	domain.JoinVoiceDto
+}
+
+type VoiceLeaveRequest struct {
+	MeetingID string `json:"meeting_id"`
+}
+
+type VoiceStateUpdateRequest struct {
+	MeetingID string `json:"meeting_id"`
+	domain.UpdateVoiceStateDto
+}
+
+func voiceJoin(g *Gateway, s *Session, m *WSMessage) {
+	var req VoiceJoinRequest
+	if !decode(m, &req) || req.MeetingID == "" {
+		s.SendError(ErrInvalidPayload)
+		return
+	}
+	_, err := g.voiceService.JoinVoice(req.MeetingID, s.UserID, s.ID, &req.JoinVoiceDto)
+	if err != nil {
+		s.SendError(domainError(err))
+	}
+}
+
+func voiceLeave(g *Gateway, s *Session, m *WSMessage) {
+	var req VoiceLeaveRequest
+	if !decode(m, &req) || req.MeetingID == "" {
+		s.SendError(ErrInvalidPayload)
+		return
+	}
+	err := g.voiceService.LeaveVoice(req.MeetingID, s.UserID)
+	if err != nil {
+		s.SendError(domainError(err))
+	}
+}
+
+func voiceStateUpdate(g *Gateway, s *Session, m *WSMessage) {
+	var req VoiceStateUpdateRequest
+	if !decode(m, &req) || req.MeetingID == "" {
+		s.SendError(ErrInvalidPayload)
+		return
+	}
+	_, err := g.voiceService.UpdateVoiceState(req.MeetingID, s.UserID, &req.UpdateVoiceStateDto)
+	if err != nil {
+		s.SendError(domainError(err))
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package audit
+
+import (
+	"context"
+	"github.com/getsentry/sentry-go"
+	"github.com/hearky/server/pkg/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+type repository struct {
+	col *mongo.Collection
+}
+
+func NewRepository(db *mongo.Database) domain.AuditRepository {
+	return &repository{
+		col: db.Collection("audit_log"),
+	}
+}
+
+func (r *repository) CreateEntry(ctx context.Context, e *domain.AuditEntry) error {
+	_, err := r.col.InsertOne(ctx, e)
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to insert audit entry", zap.Any("entry", e), zap.Error(err))
+		return domain.ErrInternal
+	}
+	zap.L().Info("recorded audit entry", zap.String("actor", e.ActorID), zap.String("action", e.Action), zap.String("target", e.TargetID))
+	return nil
+}
+
+func (r *repository) CompleteEntry(ctx context.Context, e *domain.AuditEntry) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": e.ID}, bson.M{"$set": bson.M{
+		"result":  e.Result,
+		"error":   e.Error,
+		"details": e.Details,
+	}})
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to complete audit entry", zap.Any("entry", e), zap.Error(err))
+		return domain.ErrInternal
+	}
+	return nil
+}
+
+func (r *repository) GetEntries(ctx context.Context, limit int64) ([]*domain.AuditEntry, error) {
+	var e []*domain.AuditEntry
+	c, err := r.col.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"timestamp": -1}).SetLimit(limit))
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to find audit entries", zap.Error(err))
+		return nil, domain.ErrInternal
+	}
+	err = c.All(ctx, &e)
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to parse audit entry elements from cursor in slice", zap.Error(err))
+		return nil, domain.ErrInternal
+	}
+	if e == nil {
+		e = make([]*domain.AuditEntry, 0)
+	}
+	return e, nil
+}
@@ -0,0 +1,83 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package audit
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/hearky/server/pkg/domain"
+	"time"
+)
+
+type service struct {
+	auditRepo domain.AuditRepository
+	userRepo  domain.UserRepository
+}
+
+func NewService(auditRepository domain.AuditRepository, userRepository domain.UserRepository) domain.AuditService {
+	return &service{
+		auditRepo: auditRepository,
+		userRepo:  userRepository,
+	}
+}
+
+func (s *service) Override(ctx context.Context, uid string, p domain.Permission, action string, target string) (*domain.AuditEntry, error) {
+	// Check permissions
+	u, err := s.userRepo.GetUserByID(ctx, uid)
+	if err == domain.ErrNotFound {
+		return nil, domain.ErrForbidden
+	} else if err != nil {
+		return nil, err
+	}
+	if !u.Can(p) {
+		return nil, domain.ErrForbidden
+	}
+
+	// Record the override, it must not happen without an entry
+	e := &domain.AuditEntry{
+		ID:        uuid.New().String(),
+		ActorID:   uid,
+		Action:    action,
+		TargetID:  target,
+		Timestamp: time.Now(),
+		Result:    domain.AuditResultPending,
+	}
+	err = s.auditRepo.CreateEntry(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (s *service) Complete(e *domain.AuditEntry, err error) {
+	if e == nil {
+		return
+	}
+
+	// Define timeout, the action may have used up the time of its own context
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	e.Result = domain.AuditResultSucceeded
+	if err != nil {
+		e.Result = domain.AuditResultFailed
+		e.Error = err.Error()
+	}
+	_ = s.auditRepo.CompleteEntry(ctx, e)
+}
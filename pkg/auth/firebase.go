@@ -0,0 +1,54 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package auth
+
+import (
+	"context"
+	fbauth "firebase.google.com/go/v4/auth"
+	"github.com/getsentry/sentry-go"
+	"github.com/hearky/server/pkg/domain"
+	"go.uber.org/zap"
+)
+
+// Firebase authenticates users with Firebase ID tokens and can delete their Firebase accounts
+type Firebase struct {
+	client *fbauth.Client
+}
+
+func NewFirebase(client *fbauth.Client) *Firebase {
+	return &Firebase{client: client}
+}
+
+func (f *Firebase) Authenticate(ctx context.Context, token string) (string, error) {
+	t, err := f.client.VerifyIDTokenAndCheckRevoked(ctx, token)
+	if err != nil {
+		return "", domain.ErrInvalidToken
+	}
+	return t.UID, nil
+}
+
+func (f *Firebase) DeleteAccount(ctx context.Context, uid string) error {
+	err := f.client.DeleteUser(ctx, uid)
+	if err != nil && !fbauth.IsUserNotFound(err) {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to delete firebase user", zap.String("id", uid), zap.Error(err))
+		return domain.ErrInternal
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hearky/server/pkg/domain"
+	"go.uber.org/zap"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// leeway is the tolerated clock skew when checking the lifetime of a token
+const leeway = time.Minute
+
+// refreshInterval is the minimum time between two fetches of the key set
+const refreshInterval = 5 * time.Minute
+
+// algorithm describes the key and hash a JWS algorithm requires
+type algorithm struct {
+	kty  string
+	crv  string
+	hash crypto.Hash
+}
+
+// algorithms contains the supported JWS algorithms, a token is only verified with a key of the matching type and curve
+var algorithms = map[string]algorithm{
+	"RS256": {kty: "RSA", hash: crypto.SHA256},
+	"RS384": {kty: "RSA", hash: crypto.SHA384},
+	"RS512": {kty: "RSA", hash: crypto.SHA512},
+	"PS256": {kty: "RSA", hash: crypto.SHA256},
+	"PS384": {kty: "RSA", hash: crypto.SHA384},
+	"PS512": {kty: "RSA", hash: crypto.SHA512},
+	"ES256": {kty: "EC", crv: "P-256", hash: crypto.SHA256},
+	"ES384": {kty: "EC", crv: "P-384", hash: crypto.SHA384},
+	"ES512": {kty: "EC", crv: "P-521", hash: crypto.SHA512},
+}
+
+type oidc struct {
+	issuer   string
+	audience string
+	jwksURL  string
+	client   *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]*publicKey
+	fetchedAt time.Time
+}
+
+// publicKey is a verification key of the provider, if alg is set, the key may only be used with this algorithm
+type publicKey struct {
+	key crypto.PublicKey
+	alg string
+}
+
+// NewOIDC creates an authenticator verifying JWTs signed by an OpenID Connect provider.
+// The issuer and audience are required, otherwise tokens the provider issued for any other client would be accepted.
+// If no JWKS URL is passed, it is discovered with the configuration of the issuer.
+func NewOIDC(ctx context.Context, issuer string, jwksURL string, audience string) (domain.Authenticator, error) {
+	if issuer == "" || audience == "" {
+		return nil, errors.New("the issuer and the audience are required")
+	}
+	o := &oidc{
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		audience: audience,
+		jwksURL:  jwksURL,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	if o.jwksURL == "" {
+		var cfg struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		err := o.get(ctx, o.issuer+"/.well-known/openid-configuration", &cfg)
+		if err != nil {
+			return nil, err
+		}
+		o.jwksURL = cfg.JWKSURI
+	}
+	err := o.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type claims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *float64        `json:"exp"`
+	NotBefore *float64        `json:"nbf"`
+}
+
+func (o *oidc) Authenticate(ctx context.Context, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", domain.ErrInvalidToken
+	}
+
+	// Decode header and claims
+	var h header
+	var c claims
+	if decodeSegment(parts[0], &h) != nil || decodeSegment(parts[1], &c) != nil {
+		return "", domain.ErrInvalidToken
+	}
+
+	// Verify signature
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", domain.ErrInvalidToken
+	}
+	key, ok := o.key(ctx, h.Kid)
+	if !ok || (key.alg != "" && key.alg != h.Alg) || !verify(h.Alg, key.key, parts[0]+"."+parts[1], sig) {
+		return "", domain.ErrInvalidToken
+	}
+
+	// Verify claims
+	now := time.Now()
+	if c.Subject == "" || c.ExpiresAt == nil || now.After(unix(*c.ExpiresAt).Add(leeway)) {
+		return "", domain.ErrInvalidToken
+	}
+	if c.NotBefore != nil && now.Add(leeway).Before(unix(*c.NotBefore)) {
+		return "", domain.ErrInvalidToken
+	}
+	if strings.TrimSuffix(c.Issuer, "/") != o.issuer || !hasAudience(c.Audience, o.audience) {
+		return "", domain.ErrInvalidToken
+	}
+	return c.Subject, nil
+}
+
+// key returns the key with the passed id, the key set is fetched again if the key is unknown
+func (o *oidc) key(ctx context.Context, kid string) (*publicKey, bool) {
+	o.mu.RLock()
+	k, ok := o.keys[kid]
+	stale := time.Since(o.fetchedAt) > refreshInterval
+	o.mu.RUnlock()
+	if ok || !stale {
+		return k, ok
+	}
+
+	// The provider may have rotated its keys
+	if err := o.refresh(ctx); err != nil {
+		zap.L().Warn("failed to refresh JWKS", zap.String("url", o.jwksURL), zap.Error(err))
+		return nil, false
+	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	k, ok = o.keys[kid]
+	return k, ok
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// refresh fetches the key set of the provider, keys of unsupported types or not meant for signatures are skipped
+func (o *oidc) refresh(ctx context.Context) error {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := o.get(ctx, o.jwksURL, &set)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*publicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		pk, err := k.publicKey()
+		if err != nil {
+			zap.L().Debug("skipping JWK", zap.String("kid", k.Kid), zap.Error(err))
+			continue
+		}
+		keys[k.Kid] = &publicKey{key: pk, alg: k.Alg}
+	}
+
+	o.mu.Lock()
+	o.keys = keys
+	o.fetchedAt = time.Now()
+	o.mu.Unlock()
+	return nil
+}
+
+func (o *oidc) get(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", res.StatusCode, url)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	if k.Use != "" && k.Use != "sig" {
+		return nil, fmt.Errorf("unsupported key use %s", k.Use)
+	}
+	if a, ok := algorithms[k.Alg]; k.Alg != "" && (!ok || a.kty != k.Kty || a.crv != k.Crv) {
+		return nil, fmt.Errorf("unsupported algorithm %s for %s key", k.Alg, k.Kty)
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var c elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			c = elliptic.P256()
+		case "P-384":
+			c = elliptic.P384()
+		case "P-521":
+			c = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: c, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// verify checks the signature of the signed part of a token,
+// the key has to be of the type and curve the algorithm requires
+func verify(alg string, key crypto.PublicKey, signed string, sig []byte) bool {
+	a, ok := algorithms[alg]
+	if !ok {
+		return false
+	}
+	h := a.hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if a.kty != "RSA" {
+			return false
+		}
+		if strings.HasPrefix(alg, "PS") {
+			return rsa.VerifyPSS(k, a.hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+		return rsa.VerifyPKCS1v15(k, a.hash, digest, sig) == nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if a.kty != "EC" || k.Curve.Params().Name != a.crv || len(sig) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(k, digest, r, s)
+	}
+	return false
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// hasAudience returns true if the aud claim, which is either a string or a list of strings, contains the audience
+func hasAudience(raw json.RawMessage, audience string) bool {
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return single == audience
+	}
+	var multiple []string
+	if json.Unmarshal(raw, &multiple) != nil {
+		return false
+	}
+	for _, a := range multiple {
+		if a == audience {
+			return true
+		}
+	}
+	return false
+}
+
+func unix(t float64) time.Time {
+	return time.Unix(int64(t), 0)
+}
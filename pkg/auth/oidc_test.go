@@ -0,0 +1,259 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/hearky/server/pkg/domain"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAudience = "hearky"
+
+type testProvider struct {
+	server   *httptest.Server
+	rsaKey   *rsa.PrivateKey
+	ecKey    *ecdsa.PrivateKey
+	ec384Key *ecdsa.PrivateKey
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProvider{rsaKey: rsaKey, ecKey: ecKey, ec384Key: ec384Key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"jwks_uri": p.server.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string][]map[string]string{"keys": {
+			{
+				"kty": "RSA",
+				"kid": "rsa",
+				"n":   encode(rsaKey.N.Bytes()),
+				"e":   encode(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kty": "RSA",
+				"kid": "rsa-ps256",
+				"use": "sig",
+				"alg": "PS256",
+				"n":   encode(rsaKey.N.Bytes()),
+				"e":   encode(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kty": "RSA",
+				"kid": "rsa-enc",
+				"use": "enc",
+				"n":   encode(rsaKey.N.Bytes()),
+				"e":   encode(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kty": "EC",
+				"kid": "ec",
+				"crv": "P-256",
+				"x":   encode(ecKey.X.Bytes()),
+				"y":   encode(ecKey.Y.Bytes()),
+			},
+			{
+				"kty": "EC",
+				"kid": "ec384",
+				"crv": "P-384",
+				"x":   encode(ec384Key.X.FillBytes(make([]byte, 48))),
+				"y":   encode(ec384Key.Y.FillBytes(make([]byte, 48))),
+			},
+		}})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// sign creates a token with the passed header and claims, signed according to the alg of the header.
+// EC signatures are created with the key of the kid, so they can be made with a key not matching the alg.
+func (p *testProvider) sign(t *testing.T, h map[string]string, c map[string]interface{}) string {
+	hb, _ := json.Marshal(h)
+	cb, _ := json.Marshal(c)
+	signed := encode(hb) + "." + encode(cb)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	var err error
+	switch h["alg"] {
+	case "RS256":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, p.rsaKey, crypto.SHA256, digest[:])
+	case "PS256":
+		sig, err = rsa.SignPSS(rand.Reader, p.rsaKey, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case "ES256":
+		key := p.ecKey
+		if h["kid"] == "ec384" {
+			key = p.ec384Key
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key, digest[:])
+		sig = make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		s.FillBytes(sig[size:])
+	case "HS256":
+		// Uses the public key as secret, which a verifier confusing the algorithms would accept
+		m := hmac.New(sha256.New, p.rsaKey.N.Bytes())
+		m.Write([]byte(signed))
+		sig = m.Sum(nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + encode(sig)
+}
+
+func (p *testProvider) claims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss": p.server.URL,
+		"aud": testAudience,
+		"sub": "user",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	}
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestNewOIDC(t *testing.T) {
+	p := newTestProvider(t)
+	tests := []struct {
+		name     string
+		issuer   string
+		jwksURL  string
+		audience string
+		ok       bool
+	}{
+		{name: "discovery", issuer: p.server.URL, audience: testAudience, ok: true},
+		{name: "jwks url", issuer: p.server.URL, jwksURL: p.server.URL + "/jwks", audience: testAudience, ok: true},
+		{name: "missing issuer", jwksURL: p.server.URL + "/jwks", audience: testAudience},
+		{name: "missing audience", issuer: p.server.URL},
+		{name: "unreachable jwks", issuer: p.server.URL, jwksURL: p.server.URL + "/missing", audience: testAudience},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewOIDC(context.Background(), tt.issuer, tt.jwksURL, tt.audience)
+			if (err == nil) != tt.ok {
+				t.Errorf("NewOIDC() error = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestOIDCAuthenticate(t *testing.T) {
+	p := newTestProvider(t)
+	a, err := NewOIDC(context.Background(), p.server.URL, "", testAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs256 := map[string]string{"alg": "RS256", "kid": "rsa"}
+	with := func(k string, v interface{}) map[string]interface{} {
+		c := p.claims()
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		uid   string
+	}{
+		{name: "RS256", token: p.sign(t, rs256, p.claims()), uid: "user"},
+		{name: "ES256", token: p.sign(t, map[string]string{"alg": "ES256", "kid": "ec"}, p.claims()), uid: "user"},
+		{name: "PS256", token: p.sign(t, map[string]string{"alg": "PS256", "kid": "rsa-ps256"}, p.claims()), uid: "user"},
+		{name: "PS256 without key alg", token: p.sign(t, map[string]string{"alg": "PS256", "kid": "rsa"}, p.claims()), uid: "user"},
+		{name: "audience array", token: p.sign(t, rs256, with("aud", []string{"other", testAudience})), uid: "user"},
+		{name: "issuer with trailing slash", token: p.sign(t, rs256, with("iss", p.server.URL+"/")), uid: "user"},
+		{name: "expired within leeway", token: p.sign(t, rs256, with("exp", time.Now().Add(-leeway/2).Unix())), uid: "user"},
+		{name: "alg none", token: p.sign(t, map[string]string{"alg": "none", "kid": "rsa"}, p.claims())},
+		{name: "alg HS256", token: p.sign(t, map[string]string{"alg": "HS256", "kid": "rsa"}, p.claims())},
+		{name: "alg of other key", token: p.sign(t, map[string]string{"alg": "RS256", "kid": "ec"}, p.claims())},
+		{name: "ES256 with P-384 key", token: p.sign(t, map[string]string{"alg": "ES256", "kid": "ec384"}, p.claims())},
+		{name: "alg not matching the JWK alg", token: p.sign(t, map[string]string{"alg": "RS256", "kid": "rsa-ps256"}, p.claims())},
+		{name: "key for encryption", token: p.sign(t, map[string]string{"alg": "RS256", "kid": "rsa-enc"}, p.claims())},
+		{name: "wrong kid", token: p.sign(t, map[string]string{"alg": "RS256", "kid": "unknown"}, p.claims())},
+		{name: "missing kid", token: p.sign(t, map[string]string{"alg": "RS256"}, p.claims())},
+		{name: "expired", token: p.sign(t, rs256, with("exp", time.Now().Add(-2*leeway).Unix()))},
+		{name: "missing exp", token: p.sign(t, rs256, with("exp", nil))},
+		{name: "nbf in the future", token: p.sign(t, rs256, with("nbf", time.Now().Add(2*leeway).Unix()))},
+		{name: "wrong issuer", token: p.sign(t, rs256, with("iss", "https://attacker.example"))},
+		{name: "missing issuer", token: p.sign(t, rs256, with("iss", nil))},
+		{name: "wrong audience", token: p.sign(t, rs256, with("aud", "other"))},
+		{name: "audience array without audience", token: p.sign(t, rs256, with("aud", []string{"other", "another"}))},
+		{name: "missing audience", token: p.sign(t, rs256, with("aud", nil))},
+		{name: "missing subject", token: p.sign(t, rs256, with("sub", nil))},
+		{name: "tampered claims", token: func() string {
+			// Combine the claims of one token with the signature of another
+			tok := strings.Split(p.sign(t, rs256, p.claims()), ".")
+			other := strings.Split(p.sign(t, rs256, with("sub", "admin")), ".")
+			return tok[0] + "." + other[1] + "." + tok[2]
+		}()},
+		{name: "malformed", token: "not-a-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uid, err := a.Authenticate(context.Background(), tt.token)
+			if tt.uid == "" {
+				if err != domain.ErrInvalidToken {
+					t.Errorf("Authenticate() = %q, %v, want %v", uid, err, domain.ErrInvalidToken)
+				}
+				return
+			}
+			if err != nil || uid != tt.uid {
+				t.Errorf("Authenticate() = %q, %v, want %q", uid, err, tt.uid)
+			}
+		})
+	}
+}
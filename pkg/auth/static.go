@@ -0,0 +1,42 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package auth
+
+import (
+	"context"
+	"github.com/hearky/server/pkg/domain"
+)
+
+type static struct {
+	tokens map[string]string
+}
+
+// NewStatic creates an authenticator with a fixed set of tokens mapped to user ids.
+// It is meant for local development without any identity provider.
+func NewStatic(tokens map[string]string) domain.Authenticator {
+	return &static{tokens: tokens}
+}
+
+func (s *static) Authenticate(_ context.Context, token string) (string, error) {
+	uid, ok := s.tokens[token]
+	if !ok {
+		return "", domain.ErrInvalidToken
+	}
+	return uid, nil
+}
@@ -0,0 +1,109 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package block
+
+import (
+	"context"
+	"github.com/getsentry/sentry-go"
+	"github.com/hearky/server/pkg/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+type repository struct {
+	col *mongo.Collection
+}
+
+func NewRepository(db *mongo.Database) domain.BlockRepository {
+	return &repository{
+		col: db.Collection("blocks"),
+	}
+}
+
+func (r *repository) CreateBlock(ctx context.Context, b *domain.Block) error {
+	_, err := r.col.InsertOne(ctx, b)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	} else if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to insert block", zap.Any("block", b), zap.Error(err))
+		return domain.ErrInternal
+	}
+	zap.L().Info("inserted new block", zap.String("id", b.ID))
+	return nil
+}
+
+func (r *repository) IsBlocked(ctx context.Context, blocker string, blocked string) (bool, error) {
+	c, err := r.col.CountDocuments(ctx, bson.M{"_id": domain.BlockID(blocker, blocked)})
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to find block", zap.String("blocker", blocker), zap.String("blocked", blocked), zap.Error(err))
+		return false, domain.ErrInternal
+	}
+	return c > 0, nil
+}
+
+func (r *repository) GetBlocksByUser(ctx context.Context, uid string) ([]*domain.Block, error) {
+	var b []*domain.Block
+	c, err := r.col.Find(ctx, bson.M{"blocker_id": uid})
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to find blocks by user", zap.String("id", uid), zap.Error(err))
+		return nil, domain.ErrInternal
+	}
+	err = c.All(ctx, &b)
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to parse block elements from cursor in slice", zap.Error(err))
+		return nil, domain.ErrInternal
+	}
+	if b == nil {
+		b = make([]*domain.Block, 0)
+	}
+	return b, nil
+}
+
+func (r *repository) DeleteBlock(ctx context.Context, blocker string, blocked string) error {
+	res, err := r.col.DeleteOne(ctx, bson.M{"_id": domain.BlockID(blocker, blocked)})
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to delete block", zap.String("blocker", blocker), zap.String("blocked", blocked), zap.Error(err))
+		return domain.ErrInternal
+	}
+	if res.DeletedCount == 0 {
+		return domain.ErrNotFound
+	}
+	zap.L().Info("deleted block", zap.String("blocker", blocker), zap.String("blocked", blocked))
+	return nil
+}
+
+// DeleteBlocksByUser deletes all blocks by and of the user
+func (r *repository) DeleteBlocksByUser(ctx context.Context, uid string) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"$or": []bson.M{
+		{"blocker_id": uid},
+		{"blocked_id": uid},
+	}})
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to delete blocks by user", zap.String("id", uid), zap.Error(err))
+		return domain.ErrInternal
+	}
+	return nil
+}
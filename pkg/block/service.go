@@ -0,0 +1,127 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package block
+
+import (
+	"context"
+	"github.com/hearky/server/pkg/domain"
+	"time"
+)
+
+type service struct {
+	blockRepo  domain.BlockRepository
+	userRepo   domain.UserRepository
+	friendRepo domain.FriendshipRepository
+	inviteRepo domain.InviteRepository
+	voice      domain.VoiceService
+	events     domain.EventBus
+}
+
+func NewService(blockRepository domain.BlockRepository, userRepository domain.UserRepository, friendshipRepository domain.FriendshipRepository, inviteRepository domain.InviteRepository, voiceService domain.VoiceService, eventBus domain.EventBus) domain.BlockService {
+	return &service{
+		blockRepo:  blockRepository,
+		userRepo:   userRepository,
+		friendRepo: friendshipRepository,
+		inviteRepo: inviteRepository,
+		voice:      voiceService,
+		events:     eventBus,
+	}
+}
+
+func (s *service) GetBlocks(uid string) ([]*domain.Block, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Fetch blocks
+	b, err := s.blockRepo.GetBlocksByUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *service) BlockUser(target string, uid string) error {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Check if the user exists
+	if target == uid {
+		return domain.ErrInvalidInput
+	}
+	_, err := s.userRepo.GetUserByID(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	// Create block
+	err = s.blockRepo.CreateBlock(ctx, &domain.Block{
+		ID:        domain.BlockID(uid, target),
+		BlockerID: uid,
+		BlockedID: target,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// End the friendship, the blocked user is not told why
+	f, err := s.friendRepo.GetFriendship(ctx, uid, target)
+	if err == nil && s.friendRepo.DeleteFriendship(ctx, uid, target) == nil {
+		t := domain.EventFriendRequestDelete
+		if f.IsAccepted() {
+			t = domain.EventFriendRemove
+		}
+		s.events.Publish(&domain.Event{
+			Type:    t,
+			UserIDs: []string{f.RequesterID, f.AddresseeID},
+			Data:    f,
+		})
+	}
+
+	// Remove the blocked user from the voice room of the blocker's meetings, they could not join it anymore
+	s.voice.KickBlocked(target, uid)
+
+	// Decline all pending invites of the blocked user, only the blocker gets notified
+	is, err := s.inviteRepo.GetInvitesByReceiver(ctx, uid)
+	if err != nil {
+		return err
+	}
+	for _, i := range is {
+		if i.SenderID != target || s.inviteRepo.ResolveInvite(ctx, i.ID, domain.InviteStatusDeclined) != nil {
+			continue
+		}
+		i.Status = domain.InviteStatusDeclined
+		s.events.Publish(&domain.Event{
+			Type:    domain.EventInviteDelete,
+			UserIDs: []string{uid},
+			Data:    i,
+		})
+	}
+	return nil
+}
+
+func (s *service) UnblockUser(target string, uid string) error {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	return s.blockRepo.DeleteBlock(ctx, uid, target)
+}
@@ -0,0 +1,94 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package broker
+
+import (
+	"context"
+	"github.com/hearky/server/pkg/domain"
+	"go.uber.org/zap"
+	"sync"
+)
+
+// queueSize is the amount of messages which can be buffered before new ones get dropped
+const queueSize = 1024
+
+type message struct {
+	channel string
+	payload []byte
+}
+
+type memoryBroker struct {
+	mu       sync.RWMutex
+	handlers map[string][]func(payload []byte)
+	queue    chan *message
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewMemory creates a broker which only delivers messages within this process,
+// it is meant for single node deployments
+func NewMemory() domain.Broker {
+	b := &memoryBroker{
+		handlers: make(map[string][]func(payload []byte)),
+		queue:    make(chan *message, queueSize),
+		done:     make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *memoryBroker) Publish(_ context.Context, channel string, payload []byte) error {
+	select {
+	case <-b.done:
+	case b.queue <- &message{channel: channel, payload: payload}:
+	default:
+		zap.L().Warn("broker queue is full, dropping message", zap.String("channel", channel))
+	}
+	return nil
+}
+
+func (b *memoryBroker) Subscribe(channel string, h func(payload []byte)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[channel] = append(b.handlers[channel], h)
+	return nil
+}
+
+func (b *memoryBroker) Close() error {
+	b.once.Do(func() {
+		close(b.done)
+	})
+	return nil
+}
+
+func (b *memoryBroker) run() {
+	for {
+		select {
+		case <-b.done:
+			return
+		case m := <-b.queue:
+			b.mu.RLock()
+			hs := b.handlers[m.channel]
+			b.mu.RUnlock()
+			for _, h := range hs {
+				h(m.payload)
+			}
+		}
+	}
+}
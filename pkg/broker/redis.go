@@ -0,0 +1,86 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package broker
+
+import (
+	"context"
+	"github.com/getsentry/sentry-go"
+	"github.com/go-redis/redis/v8"
+	"github.com/hearky/server/pkg/domain"
+	"go.uber.org/zap"
+	"sync"
+)
+
+type redisBroker struct {
+	client *redis.Client
+
+	mu   sync.Mutex
+	subs []*redis.PubSub
+}
+
+// NewRedis creates a broker which exchanges messages with other server instances over Redis Pub/Sub
+func NewRedis(client *redis.Client) domain.Broker {
+	return &redisBroker{
+		client: client,
+	}
+}
+
+func (b *redisBroker) Publish(ctx context.Context, channel string, payload []byte) error {
+	err := b.client.Publish(ctx, channel, payload).Err()
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to publish message", zap.String("channel", channel), zap.Error(err))
+		return domain.ErrInternal
+	}
+	return nil
+}
+
+func (b *redisBroker) Subscribe(channel string, h func(payload []byte)) error {
+	ps := b.client.Subscribe(context.Background(), channel)
+
+	// Wait for the confirmation, so no message published afterwards gets lost
+	_, err := ps.Receive(context.Background())
+	if err != nil {
+		_ = ps.Close()
+		sentry.CaptureException(err)
+		zap.L().Error("failed to subscribe to channel", zap.String("channel", channel), zap.Error(err))
+		return domain.ErrInternal
+	}
+
+	b.mu.Lock()
+	b.subs = append(b.subs, ps)
+	b.mu.Unlock()
+
+	go func() {
+		for m := range ps.Channel() {
+			h([]byte(m.Payload))
+		}
+	}()
+	return nil
+}
+
+func (b *redisBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, ps := range b.subs {
+		_ = ps.Close()
+	}
+	b.subs = nil
+	return b.client.Close()
+}
@@ -20,17 +20,36 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
 )
 
 type Config struct {
-	Dev         bool   `default:"false"`
-	WebAddress  string `default:":3000" envconfig:"WEB_ADDRESS"`
-	SentryDsn   string `envconfig:"SENTRY_DSN"`
-	MongoURI    string `envconfig:"MONGO_URI" required:"true"`
-	MongoDBName string `envconfig:"MONGO_DB_NAME" default:"hearky"`
+	Dev         bool          `default:"false"`
+	WebAddress  string        `default:":3000" envconfig:"WEB_ADDRESS"`
+	SentryDsn   string        `envconfig:"SENTRY_DSN"`
+	MongoURI    string        `envconfig:"MONGO_URI" required:"true"`
+	MongoDBName string        `envconfig:"MONGO_DB_NAME" default:"hearky"`
+	RedisURL    string        `envconfig:"REDIS_URL"`
+	TurnSecret  string        `envconfig:"TURN_SECRET"`
+	TurnServers []string      `envconfig:"TURN_SERVERS"`
+	TurnTTL     time.Duration `envconfig:"TURN_TTL" default:"1h"`
+	StunServers []string      `envconfig:"STUN_SERVERS"`
+	// AuthProvider verifies the tokens of users, either firebase, oidc or static
+	AuthProvider        string `envconfig:"AUTH_PROVIDER" default:"firebase"`
+	FirebaseCredentials string `envconfig:"FIREBASE_CREDENTIALS" default:"serviceAccountKey.json"`
+	// OIDCIssuer and OIDCAudience are required by the oidc provider, the JWKS URL is discovered if omitted
+	OIDCIssuer   string `envconfig:"OIDC_ISSUER"`
+	OIDCJWKSURL  string `envconfig:"OIDC_JWKS_URL"`
+	OIDCAudience string `envconfig:"OIDC_AUDIENCE"`
+	// StaticTokens maps tokens to user ids as token:uid pairs, only allowed in dev mode
+	StaticTokens map[string]string `envconfig:"STATIC_TOKENS"`
+	// MongoStandalone allows a MongoDB server without transaction support, units of work are not atomic then
+	MongoStandalone bool `envconfig:"MONGO_STANDALONE" default:"false"`
+	// DeleteAuthAccounts also deletes the Firebase account when a user deletes their Hearky account
+	DeleteAuthAccounts bool `envconfig:"DELETE_AUTH_ACCOUNTS" default:"false"`
 }
 
 func Load() *Config {
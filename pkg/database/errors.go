@@ -0,0 +1,33 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package database
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver"
+)
+
+// IsTransient returns true if the error aborted a transaction which succeeds when it gets run again,
+// e.g. because of a write conflict with a concurrent transaction.
+// Repositories return domain.ErrConflict for these errors, so the unit of work can be retried with domain.RetryOnConflict.
+func IsTransient(err error) bool {
+	var se mongo.ServerError
+	return errors.As(err, &se) && se.HasErrorLabel(driver.TransientTransactionError)
+}
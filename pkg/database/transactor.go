@@ -0,0 +1,81 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/getsentry/sentry-go"
+	"github.com/hearky/server/pkg/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+type transactor struct {
+	client    *mongo.Client
+	supported bool
+}
+
+// NewTransactor creates a transactor running units of work in MongoDB transactions.
+// Transactions are only supported by replica sets and sharded clusters. On a standalone server it fails,
+// unless allowStandalone is set, then the units of work are executed without a transaction.
+func NewTransactor(ctx context.Context, client *mongo.Client, allowStandalone bool) (domain.Transactor, error) {
+	var res struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := client.Database("admin").RunCommand(ctx, bson.M{"isMaster": 1}).Decode(&res)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &transactor{
+		client:    client,
+		supported: res.SetName != "" || res.Msg == "isdbgrid",
+	}
+	if !t.supported && !allowStandalone {
+		return nil, errors.New("MongoDB does not support transactions, run it as a replica set or allow a standalone server")
+	} else if !t.supported {
+		zap.L().Warn("MongoDB does not support transactions, units of work are not atomic")
+	}
+	return t, nil
+}
+
+func (t *transactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !t.supported {
+		return fn(ctx)
+	}
+
+	// Errors of the unit of work are already domain errors, all others come from the driver
+	var fnErr error
+	err := t.client.UseSession(ctx, func(sc mongo.SessionContext) error {
+		_, err := sc.WithTransaction(sc, func(sc mongo.SessionContext) (interface{}, error) {
+			fnErr = fn(sc)
+			return nil, fnErr
+		})
+		return err
+	})
+	if err != nil && err != fnErr {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to run transaction", zap.Error(err))
+		return domain.ErrInternal
+	}
+	return err
+}
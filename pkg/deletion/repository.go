@@ -0,0 +1,105 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package deletion
+
+import (
+	"context"
+	"github.com/getsentry/sentry-go"
+	"github.com/hearky/server/pkg/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+type repository struct {
+	col *mongo.Collection
+}
+
+func NewRepository(db *mongo.Database) domain.DeletionJobRepository {
+	return &repository{
+		col: db.Collection("deletion_jobs"),
+	}
+}
+
+func (r *repository) CreateJob(ctx context.Context, j *domain.DeletionJob) error {
+	_, err := r.col.InsertOne(ctx, j)
+	if mongo.IsDuplicateKeyError(err) {
+		return domain.ErrConflict
+	} else if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to insert deletion job", zap.Any("job", j), zap.Error(err))
+		return domain.ErrInternal
+	}
+	zap.L().Info("inserted new deletion job", zap.String("user", j.UserID))
+	return nil
+}
+
+func (r *repository) GetJobByUser(ctx context.Context, uid string) (*domain.DeletionJob, error) {
+	var j domain.DeletionJob
+	err := r.col.FindOne(ctx, bson.M{"_id": uid}).Decode(&j)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrNotFound
+	} else if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to find deletion job by user", zap.String("user", uid), zap.Error(err))
+		return nil, domain.ErrInternal
+	}
+	return &j, nil
+}
+
+func (r *repository) GetJobs(ctx context.Context) ([]*domain.DeletionJob, error) {
+	var j []*domain.DeletionJob
+	c, err := r.col.Find(ctx, bson.M{})
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to find deletion jobs", zap.Error(err))
+		return nil, domain.ErrInternal
+	}
+	err = c.All(ctx, &j)
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to parse deletion job elements from cursor in slice", zap.Error(err))
+		return nil, domain.ErrInternal
+	}
+	if j == nil {
+		j = make([]*domain.DeletionJob, 0)
+	}
+	return j, nil
+}
+
+func (r *repository) SaveJob(ctx context.Context, j *domain.DeletionJob) error {
+	_, err := r.col.ReplaceOne(ctx, bson.M{"_id": j.UserID}, j)
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to update deletion job", zap.Any("job", j), zap.Error(err))
+		return domain.ErrInternal
+	}
+	return nil
+}
+
+func (r *repository) DeleteJob(ctx context.Context, uid string) error {
+	_, err := r.col.DeleteOne(ctx, bson.M{"_id": uid})
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to delete deletion job", zap.String("user", uid), zap.Error(err))
+		return domain.ErrInternal
+	}
+	zap.L().Info("deleted deletion job", zap.String("user", uid))
+	return nil
+}
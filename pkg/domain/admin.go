@@ -0,0 +1,54 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package domain
+
+// AdminUserInvites contains all invites sent and received by a user
+type AdminUserInvites struct {
+	Sent     []*Invite `json:"sent"`
+	Received []*Invite `json:"received"`
+}
+
+// ResetUsernameDto represents the new username of a user, if it is empty, a random one is generated
+type ResetUsernameDto struct {
+	Username string `json:"username"`
+}
+
+// UpdateUserUpgradeDto represents the changes of the upgrade of a user, omitted fields stay untouched
+type UpdateUserUpgradeDto struct {
+	ConcurrentMeetings *int `json:"concurrent_meetings"`
+}
+
+// UpdateMeetingUpgradeDto represents the changes of the upgrade of a meeting, omitted fields stay untouched
+type UpdateMeetingUpgradeDto struct {
+	Participants      *int `json:"participants"`
+	ConcurrentInvites *int `json:"concurrent_invites"`
+}
+
+// AdminService contains the actions of the support team, every action is recorded in the audit log
+type AdminService interface {
+	GetUser(id string, uid string) (*User, error)
+	GetUserByUsername(username string, uid string) (*User, error)
+	GetUserMeetings(id string, uid string) ([]*Meeting, error)
+	GetUserInvites(id string, uid string) (*AdminUserInvites, error)
+	ResetUsername(id string, dto *ResetUsernameDto, uid string) (*User, error)
+	UpdateUserUpgrade(id string, dto *UpdateUserUpgradeDto, uid string) (*User, error)
+	DeleteMeeting(mid string, uid string) error
+	UpdateMeetingUpgrade(mid string, dto *UpdateMeetingUpgradeDto, uid string) (*Meeting, error)
+	GetAuditLog(limit int64, uid string) ([]*AuditEntry, error)
+}
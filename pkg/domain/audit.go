@@ -0,0 +1,82 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditActionReadUser             = "user.read"
+	AuditActionReadUserMeetings     = "user.meetings.read"
+	AuditActionReadUserInvites      = "user.invites.read"
+	AuditActionDeleteUser           = "user.delete"
+	AuditActionResetUsername        = "user.username.reset"
+	AuditActionUpdateUserUpgrade    = "user.upgrade.update"
+	AuditActionReadMeeting          = "meeting.read"
+	AuditActionDeleteMeeting        = "meeting.delete"
+	AuditActionUpdateMeetingUpgrade = "meeting.upgrade.update"
+	AuditActionReadAuditLog         = "audit.read"
+)
+
+// Results of an audited action, entries are pending until the action completed
+const (
+	AuditResultPending   = "pending"
+	AuditResultSucceeded = "succeeded"
+	AuditResultFailed    = "failed"
+)
+
+// AuditEntry records an action a user performed with elevated permissions
+type AuditEntry struct {
+	ID        string    `json:"id" bson:"_id"`
+	ActorID   string    `json:"actor_id" bson:"actor_id"`
+	Action    string    `json:"action"`
+	TargetID  string    `json:"target_id" bson:"target_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Result    string    `json:"result"`
+	// Error contains the reason the action failed
+	Error string `json:"error,omitempty" bson:"error,omitempty"`
+	// Details contains the values an action changed, before and after it
+	Details *AuditDetails `json:"details,omitempty" bson:"details,omitempty"`
+}
+
+// AuditDetails contains the changed values of a resource, keyed by their field
+type AuditDetails struct {
+	Before map[string]interface{} `json:"before"`
+	After  map[string]interface{} `json:"after"`
+}
+
+// AuditRepository defines an interface for managing the audit log in the database
+type AuditRepository interface {
+	CreateEntry(ctx context.Context, e *AuditEntry) error
+	// CompleteEntry records the result of the action of the entry
+	CompleteEntry(ctx context.Context, e *AuditEntry) error
+	GetEntries(ctx context.Context, limit int64) ([]*AuditEntry, error)
+}
+
+// AuditService checks elevated permissions and records their usage
+type AuditService interface {
+	// Override returns a pending entry if the user has the permission, the action on the target is recorded in the audit log
+	// before it happens. Otherwise it returns ErrForbidden.
+	Override(ctx context.Context, uid string, p Permission, action string, target string) (*AuditEntry, error)
+	// Complete records the result of the action of an entry returned by Override, nil entries are ignored
+	Complete(e *AuditEntry, err error)
+}
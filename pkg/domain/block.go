@@ -0,0 +1,52 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Block represents a user blocking another user
+type Block struct {
+	ID        string    `json:"-" bson:"_id"`
+	BlockerID string    `json:"blocker_id" bson:"blocker_id"`
+	BlockedID string    `json:"blocked_id" bson:"blocked_id"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// BlockRepository defines an interface for managing blocks in the database
+type BlockRepository interface {
+	CreateBlock(ctx context.Context, b *Block) error
+	IsBlocked(ctx context.Context, blocker string, blocked string) (bool, error)
+	GetBlocksByUser(ctx context.Context, uid string) ([]*Block, error)
+	DeleteBlock(ctx context.Context, blocker string, blocked string) error
+	DeleteBlocksByUser(ctx context.Context, uid string) error
+}
+
+type BlockService interface {
+	GetBlocks(uid string) ([]*Block, error)
+	BlockUser(target string, uid string) error
+	UnblockUser(target string, uid string) error
+}
+
+// BlockID returns the id of the block of the blocked user by the blocker
+func BlockID(blocker string, blocked string) string {
+	return blocker + ":" + blocked
+}
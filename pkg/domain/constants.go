@@ -18,8 +18,25 @@
 
 package domain
 
+import "time"
+
 var (
 	MaxConcurrentMeetings    = 3
 	MaxParticipantsFree      = 5
 	MaxConcurrentInvitesFree = 10
+	MaxBulkInvites           = 50
+
+	MaxMeetingNameLength        = 64
+	MaxMeetingDescriptionLength = 1024
+	MaxMeetingTopicLength       = 128
+
+	MinUsernameLength = 3
+	MaxUsernameLength = 32
+
+	MaxConflictRetries = 5
+
+	// InviteLifetime is the time after which a pending invite expires
+	InviteLifetime = 7 * 24 * time.Hour
+	// InviteHistoryRetention is the time resolved invites are kept for the history of a meeting
+	InviteHistoryRetention = 90 * 24 * time.Hour
 )
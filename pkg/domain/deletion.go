@@ -0,0 +1,63 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Steps of an account deletion, they are executed in this order
+const (
+	DeletionStepRevokeSentInvites = iota
+	DeletionStepDeleteReceivedInvites
+	DeletionStepLeaveMeetings
+	// The account used to be deleted at this step, jobs stored at it continue with the next one
+	deletionStepUnused
+	DeletionStepDeleteUser
+	DeletionStepDeleteFriendships
+	DeletionStepDeleteBlocks
+	// The account is deleted last, so no data remains stored without an account if a step fails
+	DeletionStepDeleteAccount
+	DeletionStepDone
+)
+
+// DeletionJob tracks the progress of an account deletion, so it can be resumed if a step failed
+type DeletionJob struct {
+	UserID    string    `json:"user_id" bson:"_id"`
+	Step      int       `json:"step"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error" bson:"last_error"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// DeletionJobRepository defines an interface for managing deletion jobs in the database
+type DeletionJobRepository interface {
+	CreateJob(ctx context.Context, j *DeletionJob) error
+	GetJobByUser(ctx context.Context, uid string) (*DeletionJob, error)
+	GetJobs(ctx context.Context) ([]*DeletionJob, error)
+	SaveJob(ctx context.Context, j *DeletionJob) error
+	DeleteJob(ctx context.Context, uid string) error
+}
+
+// AccountDeleter deletes the account of a user at the authentication provider
+type AccountDeleter interface {
+	DeleteAccount(ctx context.Context, uid string) error
+}
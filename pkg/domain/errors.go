@@ -21,12 +21,37 @@ package domain
 import "errors"
 
 var (
-	ErrForbidden      = errors.New("forbidden")
-	ErrInternal       = errors.New("internal")
-	ErrNotFound       = errors.New("not-found")
-	ErrUsernameExists = errors.New("username-already-exists")
-	ErrUserExists     = errors.New("user-already-exists")
-	ErrInviteExists   = errors.New("invite-already-exists")
-	ErrOwnerOfMeeting = errors.New("owner-of-meeting")
-	ErrTooManyMeetings = errors.New("too-many-meetings")
+	ErrForbidden        = errors.New("forbidden")
+	ErrInternal         = errors.New("internal")
+	ErrNotFound         = errors.New("not-found")
+	ErrUsernameExists   = errors.New("username-already-exists")
+	ErrUserExists       = errors.New("user-already-exists")
+	ErrInviteExists     = errors.New("invite-already-exists")
+	ErrOwnerOfMeeting   = errors.New("owner-of-meeting")
+	ErrTooManyMeetings  = errors.New("too-many-meetings")
+	ErrUserBanned       = errors.New("user-banned")
+	ErrInvalidInput     = errors.New("invalid-input")
+	ErrConflict         = errors.New("conflict")
+	ErrMeetingFull      = errors.New("meeting-full")
+	ErrTooManyInvites   = errors.New("too-many-invites")
+	ErrAlreadyMember    = errors.New("already-member")
+	ErrFriendshipExists = errors.New("friendship-already-exists")
+	ErrNotFriends       = errors.New("not-friends")
+	ErrInvalidToken     = errors.New("invalid-token")
 )
+
+// LimitError is returned if an action exceeds a limit, it wraps the actual error
+// and tells the client how much capacity is left
+type LimitError struct {
+	Err       error
+	Limit     int
+	Remaining int
+}
+
+func (e *LimitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
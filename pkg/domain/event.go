@@ -0,0 +1,58 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package domain
+
+// Event types dispatched to the affected users
+const (
+	EventInviteCreate             = "INVITE_CREATE"
+	EventInviteDelete             = "INVITE_DELETE"
+	EventMeetingParticipantAdd    = "MEETING_PARTICIPANT_ADD"
+	EventMeetingParticipantRemove = "MEETING_PARTICIPANT_REMOVE"
+	EventMeetingBanAdd            = "MEETING_BAN_ADD"
+	EventMeetingBanRemove         = "MEETING_BAN_REMOVE"
+	EventMeetingUpdate            = "MEETING_UPDATE"
+	EventMeetingDelete            = "MEETING_DELETE"
+	EventRTCOffer                 = "RTC_OFFER"
+	EventRTCAnswer                = "RTC_ANSWER"
+	EventRTCIceCandidate          = "RTC_ICE_CANDIDATE"
+	EventVoiceStateUpdate         = "VOICE_STATE_UPDATE"
+	EventFriendRequestCreate      = "FRIEND_REQUEST_CREATE"
+	EventFriendRequestDelete      = "FRIEND_REQUEST_DELETE"
+	EventFriendAdd                = "FRIEND_ADD"
+	EventFriendRemove             = "FRIEND_REMOVE"
+)
+
+// Event represents a change the affected users get notified about
+type Event struct {
+	Type    string      `json:"t"`
+	UserIDs []string    `json:"users"`
+	Data    interface{} `json:"d"`
+}
+
+// ParticipantEvent is the payload of events concerning a single participant of a meeting
+type ParticipantEvent struct {
+	MeetingID string `json:"meeting_id"`
+	UserID    string `json:"user_id"`
+}
+
+// EventBus defines an interface for publishing events and subscribing to them
+type EventBus interface {
+	Publish(e *Event)
+	Subscribe(h func(e *Event))
+}
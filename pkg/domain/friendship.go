@@ -0,0 +1,87 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Statuses of a friendship, it stays pending until the addressee accepts the request
+const (
+	FriendshipStatusPending  = "pending"
+	FriendshipStatusAccepted = "accepted"
+)
+
+// CreateFriendRequestDto represents the needed data to send a friend request to a user,
+// who is either identified by their id or username
+type CreateFriendRequestDto struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// Friendship represents a friendship between two users or a request for it
+type Friendship struct {
+	ID          string     `json:"id" bson:"_id"`
+	RequesterID string     `json:"requester_id" bson:"requester_id"`
+	AddresseeID string     `json:"addressee_id" bson:"addressee_id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at" bson:"created_at"`
+	AcceptedAt  *time.Time `json:"accepted_at,omitempty" bson:"accepted_at,omitempty"`
+}
+
+// FriendshipRepository defines an interface for managing friendships in the database
+type FriendshipRepository interface {
+	CreateFriendship(ctx context.Context, f *Friendship) error
+	GetFriendship(ctx context.Context, uid string, other string) (*Friendship, error)
+	GetFriendshipsByUser(ctx context.Context, uid string) ([]*Friendship, error)
+	AcceptFriendship(ctx context.Context, uid string, other string) error
+	DeleteFriendship(ctx context.Context, uid string, other string) error
+	DeleteFriendshipsByUser(ctx context.Context, uid string) error
+}
+
+type FriendService interface {
+	GetFriends(uid string) ([]*Friendship, error)
+	GetFriendRequests(uid string) ([]*Friendship, error)
+	SendFriendRequest(dto *CreateFriendRequestDto, uid string) (*Friendship, error)
+	AcceptFriendRequest(target string, uid string) error
+	DeclineFriendRequest(target string, uid string) error
+	RemoveFriend(target string, uid string) error
+}
+
+// FriendshipID returns the id of the friendship between both users, it does not depend on their order
+func FriendshipID(uid string, other string) string {
+	if uid > other {
+		uid, other = other, uid
+	}
+	return uid + ":" + other
+}
+
+// IsAccepted returns true if both users are friends
+func (f *Friendship) IsAccepted() bool {
+	return f.Status == FriendshipStatusAccepted
+}
+
+// Other returns the user of the friendship who is not the passed user
+func (f *Friendship) Other(uid string) string {
+	if f.RequesterID == uid {
+		return f.AddresseeID
+	}
+	return f.RequesterID
+}
@@ -23,36 +23,103 @@ import (
 	"time"
 )
 
+// Statuses of an invite, only pending invites can be accepted, declined or revoked
+const (
+	InviteStatusPending  = "pending"
+	InviteStatusAccepted = "accepted"
+	InviteStatusDeclined = "declined"
+	InviteStatusRevoked  = "revoked"
+	InviteStatusExpired  = "expired"
+)
+
 type Invite struct {
-	ID         string    `json:"id" bson:"_id"`
-	SenderID   string    `json:"sender_id" bson:"sender_id"`
-	ReceiverID string    `json:"receiver_id" bson:"receiver_id"`
-	MeetingID  string    `json:"meeting_id" bson:"meeting_id"`
-	Timestamp  time.Time `json:"timestamp"`
+	ID         string     `json:"id" bson:"_id"`
+	SenderID   string     `json:"sender_id" bson:"sender_id"`
+	ReceiverID string     `json:"receiver_id" bson:"receiver_id"`
+	MeetingID  string     `json:"meeting_id" bson:"meeting_id"`
+	Timestamp  time.Time  `json:"timestamp"`
+	Status     string     `json:"status"`
+	ExpiresAt  time.Time  `json:"expires_at" bson:"expires_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty" bson:"resolved_at,omitempty"`
+	// Suppressed invites were sent to a user who blocked the sender, only the organizers of the meeting see them
+	Suppressed bool `json:"-" bson:"suppressed,omitempty"`
 }
 
+// CreateInviteDto represents the needed data to invite a user, who is either identified by their id or username
 type CreateInviteDto struct {
 	ReceiverID string `json:"receiver_id"`
+	Username   string `json:"username"`
 	MeetingID  string `json:"meeting_id"`
 }
 
+// CreateInvitesDto represents the needed data to invite multiple users at once
+type CreateInvitesDto struct {
+	ReceiverIDs []string `json:"receiver_ids"`
+	Usernames   []string `json:"usernames"`
+	MeetingID   string   `json:"meeting_id"`
+}
+
+// InviteResult tells whether a user of a bulk invite was invited, if not, Error contains the reason.
+// If the invite limit of the meeting was reached, Limit and Remaining tell its capacity.
+type InviteResult struct {
+	ReceiverID string  `json:"receiver_id,omitempty"`
+	Username   string  `json:"username,omitempty"`
+	Invite     *Invite `json:"invite,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	Limit      int     `json:"limit,omitempty"`
+	Remaining  *int    `json:"remaining,omitempty"`
+}
+
+// InviteRepository defines an interface for managing invites in the database.
+// Unless stated otherwise, the methods only return pending invites.
+// The receiver based methods skip suppressed invites, except for GetInviteHistoryByReceiver.
 type InviteRepository interface {
 	CreateInvite(ctx context.Context, i *Invite) error
+	// GetInviteByID returns the invite regardless of its status
 	GetInviteByID(ctx context.Context, id string) (*Invite, error)
 	GetInvitesByReceiver(ctx context.Context, uid string) ([]*Invite, error)
 	GetInvitesByReceiverCount(ctx context.Context, uid string) (int64, error)
+	// GetInvitesBySender returns all invites sent by the user regardless of their status
+	GetInvitesBySender(ctx context.Context, uid string) ([]*Invite, error)
 	GetInvitesByMeeting(ctx context.Context, mid string) ([]*Invite, error)
 	GetInvitesByMeetingCount(ctx context.Context, mid string) (int64, error)
 	GetInviteByReceiverAndMeeting(ctx context.Context, uid string, mid string) (*Invite, error)
+	// GetInviteHistoryByReceiver returns all invites received by the user regardless of their status
+	GetInviteHistoryByReceiver(ctx context.Context, uid string) ([]*Invite, error)
+	// GetInviteHistoryByMeeting returns all invites of the meeting regardless of their status
+	GetInviteHistoryByMeeting(ctx context.Context, mid string) ([]*Invite, error)
+	// GetExpiredInvites returns all pending invites which are expired
+	GetExpiredInvites(ctx context.Context) ([]*Invite, error)
+	// ResolveInvite changes the status of a pending invite, it fails with ErrNotFound if the invite is not pending anymore.
+	// Resolving an invite as expired only requires it to be unresolved, as it is not pending after its expiry.
+	ResolveInvite(ctx context.Context, id string, status string) error
 	DeleteInvite(ctx context.Context, id string) error
+	DeleteInvitesByMeeting(ctx context.Context, mid string) error
 }
 
 type InviteService interface {
 	SendInvite(dto *CreateInviteDto, uid string) error
+	SendInvites(dto *CreateInvitesDto, uid string) ([]*InviteResult, error)
 	GetInvitesByReceiver(uid string) ([]*Invite, error)
 	GetInvitesByReceiverCount(uid string) (int64, error)
 	GetInvitesByMeeting(mid string, uid string) ([]*Invite, error)
 	GetInvitesByMeetingCount(mid string, uid string) (int64, error)
+	GetInviteHistoryByMeeting(mid string, uid string) ([]*Invite, error)
 	AcceptInvite(id string, uid string) error
-	DeleteInvite(id string, uid string) error
+	DeclineInvite(id string, uid string) error
+	RevokeInvite(id string, uid string) error
+}
+
+// RecipientIDs returns the users notified about changes of the invite, the receiver is left out if it is suppressed
+func (i *Invite) RecipientIDs(organizerIDs []string) []string {
+	uids := append([]string(nil), organizerIDs...)
+	if !i.Suppressed {
+		uids = append(uids, i.ReceiverID)
+	}
+	return uids
+}
+
+// IsPending returns true if the invite can still be accepted, declined or revoked
+func (i *Invite) IsPending() bool {
+	return (i.Status == "" || i.Status == InviteStatusPending) && (i.ExpiresAt.IsZero() || time.Now().Before(i.ExpiresAt))
 }
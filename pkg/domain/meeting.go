@@ -21,19 +21,57 @@ package domain
 import "context"
 
 // CreateMeetingDto represents the needed data to create a new meeting
+// Participants and Usernames both identify users who get invited to the meeting
 type CreateMeetingDto struct {
 	Name         string   `json:"name"`
 	Participants []string `json:"participants"`
+	Usernames    []string `json:"usernames"`
+}
+
+// CreateMeetingResult contains the id of a created meeting and the results of the initial invites
+type CreateMeetingResult struct {
+	ID      string          `json:"id"`
+	Invites []*InviteResult `json:"invites"`
+}
+
+// TransferOwnershipDto represents the needed data to transfer the ownership of a meeting
+type TransferOwnershipDto struct {
+	OwnerID string `json:"owner_id"`
+}
+
+// UpdateMeetingDto represents the changes of a meeting, omitted fields stay untouched.
+// If a version is passed, the update fails if the meeting was changed in the meantime.
+type UpdateMeetingDto struct {
+	Name        *string                   `json:"name"`
+	Description *string                   `json:"description"`
+	Topic       *string                   `json:"topic"`
+	Settings    *UpdateMeetingSettingsDto `json:"settings"`
+	Version     *int64                    `json:"version"`
+}
+
+// UpdateMeetingSettingsDto represents the changes of the settings of a meeting
+type UpdateMeetingSettingsDto struct {
+	MuteOnJoin *bool `json:"mute_on_join"`
 }
 
 // Meeting represents a Hearky meeting
 type Meeting struct {
-	ID           string         `json:"id" bson:"_id"`
-	Name         string         `json:"name"`
-	OwnerID      string         `json:"owner_id" bson:"owner_id"`
-	Organizers   []string       `json:"organizers"`
-	Participants []string       `json:"participants"`
-	Upgrade      MeetingUpgrade `json:"upgrade"`
+	ID           string          `json:"id" bson:"_id"`
+	Name         string          `json:"name"`
+	Description  string          `json:"description"`
+	Topic        string          `json:"topic"`
+	OwnerID      string          `json:"owner_id" bson:"owner_id"`
+	Organizers   []string        `json:"organizers"`
+	Participants []string        `json:"participants"`
+	Banned       []string        `json:"banned"`
+	Settings     MeetingSettings `json:"settings"`
+	Upgrade      MeetingUpgrade  `json:"upgrade"`
+	Version      int64           `json:"version"`
+}
+
+// MeetingSettings contains the settings organizers can change
+type MeetingSettings struct {
+	MuteOnJoin bool `json:"mute_on_join" bson:"mute_on_join"`
 }
 
 // MeetingUpgrade contains the upgrade data
@@ -52,6 +90,10 @@ type PartialMeeting struct {
 type MeetingRepository interface {
 	CreateMeeting(ctx context.Context, m *Meeting) error
 	SaveMeeting(ctx context.Context, m *Meeting) error
+	AddParticipant(ctx context.Context, id string, uid string) error
+	RemoveParticipant(ctx context.Context, id string, uid string) error
+	// LockMeeting writes to the meeting without changing it, so concurrent transactions locking it conflict
+	LockMeeting(ctx context.Context, id string) error
 	GetMeetingByID(ctx context.Context, id string) (*Meeting, error)
 	GetMeetingsByUser(ctx context.Context, id string) ([]*Meeting, error)
 	GetMeetingsByUserCount(ctx context.Context, id string) (int64, error)
@@ -59,11 +101,19 @@ type MeetingRepository interface {
 }
 
 type MeetingService interface {
-	CreateMeeting(dto *CreateMeetingDto, uid string) (string, error)
+	CreateMeeting(dto *CreateMeetingDto, uid string) (*CreateMeetingResult, error)
 	GetMeetingByID(mid string, uid string) (*Meeting, error)
+	UpdateMeeting(mid string, dto *UpdateMeetingDto, uid string) (*Meeting, error)
 	GetMeetingsByUser(uid string) ([]*Meeting, error)
 	GetMeetingsByUserCount(uid string) (int64, error)
 	DeleteMeeting(mid string, uid string) error
+	LeaveMeeting(mid string, uid string) error
+	RemoveParticipant(mid string, target string, uid string) error
+	BanUser(mid string, target string, uid string) error
+	UnbanUser(mid string, target string, uid string) error
+	PromoteOrganizer(mid string, target string, uid string) error
+	DemoteOrganizer(mid string, target string, uid string) error
+	TransferOwnership(mid string, dto *TransferOwnershipDto, uid string) error
 }
 
 // AsPartial returns a subset of a Meeting with only the necessary data
@@ -102,6 +152,20 @@ func (m *Meeting) IsParticipant(uid string) bool {
 	return m.IsOrganizer(uid)
 }
 
+// IsBanned returns true if the passed user is banned from the meeting
+func (m *Meeting) IsBanned(uid string) bool {
+	return contains(m.Banned, uid)
+}
+
+// CanModerate returns true if the passed user is allowed to moderate the target,
+// organizers can moderate participants and only the owner can moderate organizers
+func (m *Meeting) CanModerate(uid string, target string) bool {
+	if uid == target || m.IsOwner(target) || !m.IsOrganizer(uid) {
+		return false
+	}
+	return !m.IsOrganizer(target) || m.IsOwner(uid)
+}
+
 // AddOrganizer adds a new organizer to the meeting
 func (m *Meeting) AddOrganizer(uid string) {
 	m.Organizers = append(m.Organizers, uid)
@@ -111,3 +175,57 @@ func (m *Meeting) AddOrganizer(uid string) {
 func (m *Meeting) AddParticipant(uid string) {
 	m.Participants = append(m.Participants, uid)
 }
+
+// OrganizerIDs returns the owner and all organizers of the meeting
+func (m *Meeting) OrganizerIDs() []string {
+	ids := []string{m.OwnerID}
+	for _, o := range m.Organizers {
+		if o != m.OwnerID {
+			ids = append(ids, o)
+		}
+	}
+	return ids
+}
+
+// MemberIDs returns the owner, the organizers and all participants of the meeting
+func (m *Meeting) MemberIDs() []string {
+	ids := m.OrganizerIDs()
+	for _, p := range m.Participants {
+		if !m.IsOrganizer(p) {
+			ids = append(ids, p)
+		}
+	}
+	return ids
+}
+
+// RemoveOrganizer removes the user from the organizers of the meeting, they stay a participant
+func (m *Meeting) RemoveOrganizer(uid string) {
+	m.Organizers = remove(m.Organizers, uid)
+}
+
+// TransferOwnership makes the passed user the owner, the previous owner stays an organizer
+func (m *Meeting) TransferOwnership(uid string) {
+	prev := m.OwnerID
+	m.RemoveParticipant(uid)
+	m.OwnerID = uid
+	m.AddParticipant(prev)
+	m.AddOrganizer(prev)
+}
+
+// RemoveParticipant removes the user from the participants and organizers of the meeting
+func (m *Meeting) RemoveParticipant(uid string) {
+	m.Participants = remove(m.Participants, uid)
+	m.Organizers = remove(m.Organizers, uid)
+}
+
+// Ban adds the user to the banned users of the meeting
+func (m *Meeting) Ban(uid string) {
+	if !m.IsBanned(uid) {
+		m.Banned = append(m.Banned, uid)
+	}
+}
+
+// Unban removes the user from the banned users of the meeting
+func (m *Meeting) Unban(uid string) {
+	m.Banned = remove(m.Banned, uid)
+}
@@ -18,22 +18,83 @@
 
 package domain
 
-import "context"
+import (
+	"context"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
 
 type CreateUserDto struct {
 	Username string `json:"username"`
 }
 
+// UpdateUserSettingsDto represents the changes of the settings of a user, omitted fields stay untouched
+type UpdateUserSettingsDto struct {
+	FriendsOnlyInvites *bool `json:"friends_only_invites"`
+}
+
+// UserFlags contains the roles of a user as bits
+type UserFlags uint
+
+const (
+	FlagModerator UserFlags = 1 << iota
+	FlagAdmin
+)
+
+// Permission is an elevated permission which allows acting on resources of other users
+type Permission int
+
+const (
+	PermissionReadUsers Permission = iota
+	PermissionDeleteUsers
+	PermissionReadMeetings
+	PermissionDeleteMeetings
+	PermissionManageUsers
+	PermissionManageMeetings
+	PermissionReadAuditLog
+)
+
+// permissions maps every flag to the permissions it grants
+var permissions = map[UserFlags][]Permission{
+	FlagModerator: {PermissionReadUsers, PermissionReadMeetings},
+	FlagAdmin: {
+		PermissionReadUsers, PermissionDeleteUsers, PermissionManageUsers,
+		PermissionReadMeetings, PermissionDeleteMeetings, PermissionManageMeetings,
+		PermissionReadAuditLog,
+	},
+}
+
 type User struct {
-	ID       string      `json:"id" bson:"_id"`
-	Username string      `json:"username"`
-	Upgrade  UserUpgrade `json:"upgrade"`
+	ID       string       `json:"id" bson:"_id"`
+	Username string       `json:"username"`
+	Flags    UserFlags    `json:"flags"`
+	Settings UserSettings `json:"settings"`
+	Upgrade  UserUpgrade  `json:"upgrade"`
+	Version  int64        `json:"version"`
+}
+
+// UserSettings contains the settings a user can change
+type UserSettings struct {
+	// FriendsOnlyInvites only allows friends of the user to invite them to meetings
+	FriendsOnlyInvites bool `json:"friends_only_invites" bson:"friends_only_invites"`
 }
 
 type UserUpgrade struct {
 	ConcurrentMeetings int `json:"concurrent_meetings" bson:"concurrent_meetings"`
 }
 
+// UserExport contains all data stored about a user
+type UserExport struct {
+	ExportedAt      time.Time     `json:"exported_at"`
+	User            *User         `json:"user"`
+	Meetings        []*Meeting    `json:"meetings"`
+	InvitesSent     []*Invite     `json:"invites_sent"`
+	InvitesReceived []*Invite     `json:"invites_received"`
+	Friendships     []*Friendship `json:"friendships"`
+	Blocks          []*Block      `json:"blocks"`
+}
+
 type UserRepository interface {
 	CreateUser(ctx context.Context, u *User) error
 	GetUserByID(ctx context.Context, uid string) (*User, error)
@@ -45,5 +106,43 @@ type UserRepository interface {
 type UserService interface {
 	CreateUser(dto *CreateUserDto, uid string) error
 	GetUser(id string, uid string) (*User, error)
+	UpdateSettings(dto *UpdateUserSettingsDto, uid string) (*User, error)
 	DeleteUser(id string, uid string) error
+	ResumeDeletions()
+	ExportUser(uid string) (*UserExport, error)
+}
+
+// ValidUsername returns true if the username has a valid length
+// and only consists of letters, digits, underscores, dots and hyphens
+func ValidUsername(username string) bool {
+	n := utf8.RuneCountInString(username)
+	if n < MinUsernameLength || n > MaxUsernameLength {
+		return false
+	}
+	for _, r := range username {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// HasFlag returns true if the user has the passed flag
+func (u *User) HasFlag(f UserFlags) bool {
+	return u.Flags&f == f
+}
+
+// Can returns true if any flag of the user grants the passed permission
+func (u *User) Can(p Permission) bool {
+	for f, ps := range permissions {
+		if !u.HasFlag(f) {
+			continue
+		}
+		for _, e := range ps {
+			if e == p {
+				return true
+			}
+		}
+	}
+	return false
 }
@@ -25,3 +25,37 @@ type IDMessage struct {
 type CountMessage struct {
 	Count int64 `json:"count"`
 }
+
+// contains returns true if the slice contains the value
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// remove returns the slice without any occurrence of the value
+func remove(s []string, v string) []string {
+	r := make([]string, 0, len(s))
+	for _, e := range s {
+		if e != v {
+			r = append(r, e)
+		}
+	}
+	return r
+}
+
+// RetryOnConflict runs fn again as long as it fails with ErrConflict, at most MaxConflictRetries times.
+// fn has to fetch the documents it modifies again on every attempt.
+func RetryOnConflict(fn func() error) error {
+	var err error
+	for i := 0; i < MaxConflictRetries; i++ {
+		err = fn()
+		if err != ErrConflict {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,60 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package domain
+
+// VoiceState represents a user connected to the voice room of a meeting
+type VoiceState struct {
+	MeetingID   string `json:"meeting_id"`
+	UserID      string `json:"user_id"`
+	SessionID   string `json:"session_id"`
+	Connected   bool   `json:"connected"`
+	Muted       bool   `json:"muted"`
+	Deafened    bool   `json:"deafened"`
+	ServerMuted bool   `json:"server_muted"`
+	Speaking    bool   `json:"speaking"`
+}
+
+// JoinVoiceDto represents the initial state of a user joining a voice room
+type JoinVoiceDto struct {
+	Muted    bool `json:"muted"`
+	Deafened bool `json:"deafened"`
+}
+
+// UpdateVoiceStateDto represents the changes of a voice state, omitted fields stay untouched
+type UpdateVoiceStateDto struct {
+	Muted    *bool `json:"muted"`
+	Deafened *bool `json:"deafened"`
+	Speaking *bool `json:"speaking"`
+}
+
+// ModerateVoiceStateDto represents the changes an organizer makes to the voice state of a participant
+type ModerateVoiceStateDto struct {
+	ServerMuted *bool `json:"server_muted"`
+}
+
+type VoiceService interface {
+	JoinVoice(mid string, uid string, sessionID string, dto *JoinVoiceDto) (*VoiceState, error)
+	LeaveVoice(mid string, uid string) error
+	UpdateVoiceState(mid string, uid string, dto *UpdateVoiceStateDto) (*VoiceState, error)
+	ModerateVoiceState(mid string, target string, uid string, dto *ModerateVoiceStateDto) (*VoiceState, error)
+	GetVoiceStates(mid string, uid string) ([]*VoiceState, error)
+	Disconnect(sessionID string)
+	// KickBlocked removes the user target, who was blocked by uid, from the voice room of a meeting owned by uid
+	KickBlocked(target string, uid string)
+}
@@ -0,0 +1,96 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/getsentry/sentry-go"
+	"github.com/hearky/server/pkg/domain"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// channel is the broker channel all events are exchanged on
+const channel = "hearky:events"
+
+type bus struct {
+	broker domain.Broker
+
+	mu       sync.RWMutex
+	handlers []func(e *domain.Event)
+}
+
+// rawEvent is an event received from the broker with its data still encoded
+type rawEvent struct {
+	Type    string          `json:"t"`
+	UserIDs []string        `json:"users"`
+	Data    json.RawMessage `json:"d"`
+}
+
+// NewBus creates an event bus which delivers events to the subscribers of every server instance
+// connected to the broker
+func NewBus(broker domain.Broker) (domain.EventBus, error) {
+	b := &bus{
+		broker: broker,
+	}
+	err := broker.Subscribe(channel, b.receive)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *bus) Publish(e *domain.Event) {
+	if len(e.UserIDs) == 0 {
+		return
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to encode event", zap.String("type", e.Type), zap.Error(err))
+		return
+	}
+
+	ctx, ccl := context.WithTimeout(context.Background(), 5*time.Second)
+	defer ccl()
+	_ = b.broker.Publish(ctx, channel, payload)
+}
+
+func (b *bus) Subscribe(h func(e *domain.Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, h)
+}
+
+func (b *bus) receive(payload []byte) {
+	var re rawEvent
+	if err := json.Unmarshal(payload, &re); err != nil {
+		zap.L().Error("failed to decode event", zap.Error(err))
+		return
+	}
+	e := &domain.Event{Type: re.Type, UserIDs: re.UserIDs, Data: re.Data}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, h := range b.handlers {
+		h(e)
+	}
+}
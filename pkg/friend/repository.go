@@ -0,0 +1,136 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package friend
+
+import (
+	"context"
+	"github.com/getsentry/sentry-go"
+	"github.com/hearky/server/pkg/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"time"
+)
+
+type repository struct {
+	col *mongo.Collection
+}
+
+func NewRepository(db *mongo.Database) domain.FriendshipRepository {
+	return &repository{
+		col: db.Collection("friendships"),
+	}
+}
+
+func (r *repository) CreateFriendship(ctx context.Context, f *domain.Friendship) error {
+	_, err := r.col.InsertOne(ctx, f)
+	if mongo.IsDuplicateKeyError(err) {
+		return domain.ErrFriendshipExists
+	} else if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to insert friendship", zap.Any("friendship", f), zap.Error(err))
+		return domain.ErrInternal
+	}
+	zap.L().Info("inserted new friendship", zap.String("id", f.ID))
+	return nil
+}
+
+func (r *repository) GetFriendship(ctx context.Context, uid string, other string) (*domain.Friendship, error) {
+	var f domain.Friendship
+	err := r.col.FindOne(ctx, bson.M{"_id": domain.FriendshipID(uid, other)}).Decode(&f)
+	if err == mongo.ErrNoDocuments {
+		return nil, domain.ErrNotFound
+	} else if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to find friendship", zap.String("user", uid), zap.String("other", other), zap.Error(err))
+		return nil, domain.ErrInternal
+	}
+	return &f, nil
+}
+
+func (r *repository) GetFriendshipsByUser(ctx context.Context, uid string) ([]*domain.Friendship, error) {
+	var f []*domain.Friendship
+	c, err := r.col.Find(ctx, bson.M{"$or": []bson.M{
+		{"requester_id": uid},
+		{"addressee_id": uid},
+	}})
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to find friendships by user", zap.String("id", uid), zap.Error(err))
+		return nil, domain.ErrInternal
+	}
+	err = c.All(ctx, &f)
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to parse friendship elements from cursor in slice", zap.Error(err))
+		return nil, domain.ErrInternal
+	}
+	if f == nil {
+		f = make([]*domain.Friendship, 0)
+	}
+	return f, nil
+}
+
+// AcceptFriendship accepts the pending request uid received from other
+func (r *repository) AcceptFriendship(ctx context.Context, uid string, other string) error {
+	res, err := r.col.UpdateOne(ctx, bson.M{
+		"_id":          domain.FriendshipID(uid, other),
+		"addressee_id": uid,
+		"status":       domain.FriendshipStatusPending,
+	}, bson.M{"$set": bson.M{
+		"status":      domain.FriendshipStatusAccepted,
+		"accepted_at": time.Now(),
+	}})
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to accept friendship", zap.String("user", uid), zap.String("other", other), zap.Error(err))
+		return domain.ErrInternal
+	}
+	if res.MatchedCount == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *repository) DeleteFriendship(ctx context.Context, uid string, other string) error {
+	res, err := r.col.DeleteOne(ctx, bson.M{"_id": domain.FriendshipID(uid, other)})
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to delete friendship", zap.String("user", uid), zap.String("other", other), zap.Error(err))
+		return domain.ErrInternal
+	}
+	if res.DeletedCount == 0 {
+		return domain.ErrNotFound
+	}
+	zap.L().Info("deleted friendship", zap.String("user", uid), zap.String("other", other))
+	return nil
+}
+
+func (r *repository) DeleteFriendshipsByUser(ctx context.Context, uid string) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"$or": []bson.M{
+		{"requester_id": uid},
+		{"addressee_id": uid},
+	}})
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to delete friendships by user", zap.String("id", uid), zap.Error(err))
+		return domain.ErrInternal
+	}
+	return nil
+}
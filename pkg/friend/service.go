@@ -0,0 +1,223 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package friend
+
+import (
+	"context"
+	"github.com/hearky/server/pkg/domain"
+	"time"
+)
+
+type service struct {
+	friendRepo domain.FriendshipRepository
+	userRepo   domain.UserRepository
+	blockRepo  domain.BlockRepository
+	events     domain.EventBus
+}
+
+func NewService(friendshipRepository domain.FriendshipRepository, userRepository domain.UserRepository, blockRepository domain.BlockRepository, eventBus domain.EventBus) domain.FriendService {
+	return &service{
+		friendRepo: friendshipRepository,
+		userRepo:   userRepository,
+		blockRepo:  blockRepository,
+		events:     eventBus,
+	}
+}
+
+func (s *service) GetFriends(uid string) ([]*domain.Friendship, error) {
+	return s.getFriendships(uid, true)
+}
+
+func (s *service) GetFriendRequests(uid string) ([]*domain.Friendship, error) {
+	return s.getFriendships(uid, false)
+}
+
+func (s *service) getFriendships(uid string, accepted bool) ([]*domain.Friendship, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Fetch friendships
+	fs, err := s.friendRepo.GetFriendshipsByUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]*domain.Friendship, 0, len(fs))
+	for _, f := range fs {
+		if f.IsAccepted() == accepted {
+			r = append(r, f)
+		}
+	}
+	return r, nil
+}
+
+func (s *service) SendFriendRequest(dto *domain.CreateFriendRequestDto, uid string) (*domain.Friendship, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Find the user
+	var u *domain.User
+	var err error
+	if dto.UserID != "" {
+		u, err = s.userRepo.GetUserByID(ctx, dto.UserID)
+	} else if dto.Username != "" {
+		u, err = s.userRepo.GetUserByUsername(ctx, dto.Username)
+	} else {
+		err = domain.ErrInvalidInput
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.ID == uid {
+		return nil, domain.ErrInvalidInput
+	}
+
+	// Users who blocked the current user are hidden from them
+	blocked, err := s.blockRepo.IsBlocked(ctx, u.ID, uid)
+	if err != nil {
+		return nil, err
+	} else if blocked {
+		return nil, domain.ErrNotFound
+	}
+	blocked, err = s.blockRepo.IsBlocked(ctx, uid, u.ID)
+	if err != nil {
+		return nil, err
+	} else if blocked {
+		return nil, domain.ErrForbidden
+	}
+
+	// If the user already sent a request to the current user, accept it instead
+	f, err := s.friendRepo.GetFriendship(ctx, uid, u.ID)
+	if err != nil && err != domain.ErrNotFound {
+		return nil, err
+	} else if err == nil {
+		if f.IsAccepted() || f.AddresseeID != uid {
+			return nil, domain.ErrFriendshipExists
+		}
+		return f, s.accept(ctx, f, uid)
+	}
+
+	// Create friend request
+	f = &domain.Friendship{
+		ID:          domain.FriendshipID(uid, u.ID),
+		RequesterID: uid,
+		AddresseeID: u.ID,
+		Status:      domain.FriendshipStatusPending,
+		CreatedAt:   time.Now(),
+	}
+	err = s.friendRepo.CreateFriendship(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	s.events.Publish(&domain.Event{
+		Type:    domain.EventFriendRequestCreate,
+		UserIDs: []string{f.RequesterID, f.AddresseeID},
+		Data:    f,
+	})
+	return f, nil
+}
+
+func (s *service) AcceptFriendRequest(target string, uid string) error {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Fetch friend request
+	f, err := s.friendRepo.GetFriendship(ctx, uid, target)
+	if err != nil {
+		return err
+	}
+
+	// Only the addressee can accept the request
+	if f.IsAccepted() || f.AddresseeID != uid {
+		return domain.ErrNotFound
+	}
+	return s.accept(ctx, f, uid)
+}
+
+func (s *service) DeclineFriendRequest(target string, uid string) error {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Fetch friend request
+	f, err := s.friendRepo.GetFriendship(ctx, uid, target)
+	if err != nil {
+		return err
+	}
+
+	// Only the addressee can decline the request
+	if f.IsAccepted() || f.AddresseeID != uid {
+		return domain.ErrNotFound
+	}
+	return s.delete(ctx, f)
+}
+
+func (s *service) RemoveFriend(target string, uid string) error {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Fetch friendship, this also cancels requests sent by the current user
+	f, err := s.friendRepo.GetFriendship(ctx, uid, target)
+	if err != nil {
+		return err
+	}
+	return s.delete(ctx, f)
+}
+
+// accept accepts the friend request uid received and notifies both users
+func (s *service) accept(ctx context.Context, f *domain.Friendship, uid string) error {
+	err := s.friendRepo.AcceptFriendship(ctx, uid, f.RequesterID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	f.Status = domain.FriendshipStatusAccepted
+	f.AcceptedAt = &now
+
+	s.events.Publish(&domain.Event{
+		Type:    domain.EventFriendAdd,
+		UserIDs: []string{f.RequesterID, f.AddresseeID},
+		Data:    f,
+	})
+	return nil
+}
+
+// delete deletes the friendship or friend request and notifies both users
+func (s *service) delete(ctx context.Context, f *domain.Friendship) error {
+	err := s.friendRepo.DeleteFriendship(ctx, f.RequesterID, f.AddresseeID)
+	if err != nil {
+		return err
+	}
+
+	t := domain.EventFriendRequestDelete
+	if f.IsAccepted() {
+		t = domain.EventFriendRemove
+	}
+	s.events.Publish(&domain.Event{
+		Type:    t,
+		UserIDs: []string{f.RequesterID, f.AddresseeID},
+		Data:    f,
+	})
+	return nil
+}
@@ -21,11 +21,14 @@ package invite
 import (
 	"context"
 	"github.com/getsentry/sentry-go"
+	"github.com/hearky/server/pkg/database"
 	"github.com/hearky/server/pkg/domain"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
+	"time"
 )
 
 type repository struct {
@@ -38,9 +41,26 @@ func NewRepository(db *mongo.Database) domain.InviteRepository {
 	}
 }
 
+// CreateIndexes creates the indexes of the invites collection,
+// resolved invites get removed by MongoDB once their retention period is over
+func CreateIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("invites").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.M{"resolved_at": 1},
+			Options: options.Index().SetExpireAfterSeconds(int32(domain.InviteHistoryRetention.Seconds())),
+		},
+		{Keys: bson.M{"receiver_id": 1}},
+		{Keys: bson.M{"meeting_id": 1}},
+	})
+	return err
+}
+
 func (r *repository) CreateInvite(ctx context.Context, i *domain.Invite) error {
 	res, err := r.col.InsertOne(ctx, i)
 	if err != nil {
+		if database.IsTransient(err) {
+			return domain.ErrConflict
+		}
 		sentry.CaptureException(err)
 		zap.L().Error("failed to insert invite", zap.Any("invite", i), zap.Error(err))
 		return domain.ErrInternal
@@ -51,7 +71,7 @@ func (r *repository) CreateInvite(ctx context.Context, i *domain.Invite) error {
 
 func (r *repository) GetInvitesByReceiver(ctx context.Context, id string) ([]*domain.Invite, error) {
 	var i []*domain.Invite
-	c, err := r.col.Find(ctx, bson.D{primitive.E{Key: "receiver_id", Value: id}})
+	c, err := r.col.Find(ctx, visible(pending(bson.M{"receiver_id": id})))
 	if err != nil {
 		sentry.CaptureException(err)
 		zap.L().Error("failed to find invites by receiver", zap.String("id", id), zap.Error(err))
@@ -69,11 +89,33 @@ func (r *repository) GetInvitesByReceiver(ctx context.Context, id string) ([]*do
 	return i, nil
 }
 
+func (r *repository) GetInvitesBySender(ctx context.Context, uid string) ([]*domain.Invite, error) {
+	var i []*domain.Invite
+	c, err := r.col.Find(ctx, bson.M{"sender_id": uid})
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to find invites by sender", zap.String("id", uid), zap.Error(err))
+		return nil, domain.ErrInternal
+	}
+	err = c.All(ctx, &i)
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to parse invite elements from cursor in slice", zap.Error(err))
+		return nil, domain.ErrInternal
+	}
+	if i == nil {
+		i = make([]*domain.Invite, 0)
+	}
+	return i, nil
+}
+
 func (r *repository) GetInviteByReceiverAndMeeting(ctx context.Context, id string, mId string) (*domain.Invite, error) {
 	var i domain.Invite
-	err := r.col.FindOne(ctx, bson.D{primitive.E{Key: "receiver_id", Value: id}, primitive.E{Key: "meeting_id", Value: mId}}).Decode(&i)
+	err := r.col.FindOne(ctx, pending(bson.M{"receiver_id": id, "meeting_id": mId})).Decode(&i)
 	if err == mongo.ErrNoDocuments {
 		return nil, domain.ErrNotFound
+	} else if database.IsTransient(err) {
+		return nil, domain.ErrConflict
 	} else if err != nil {
 		sentry.CaptureException(err)
 		zap.L().Error("failed to find invite by receiver and meeting", zap.String("id", id), zap.Error(err))
@@ -96,7 +138,7 @@ func (r *repository) GetInviteByID(ctx context.Context, id string) (*domain.Invi
 }
 
 func (r *repository) GetInvitesByReceiverCount(ctx context.Context, uid string) (int64, error) {
-	c, err := r.col.CountDocuments(ctx, bson.D{primitive.E{Key: "receiver_id", Value: uid}})
+	c, err := r.col.CountDocuments(ctx, visible(pending(bson.M{"receiver_id": uid})))
 	if err != nil {
 		sentry.CaptureException(err)
 		zap.L().Error("failed to find invite count by user", zap.String("id", uid), zap.Error(err))
@@ -107,8 +149,11 @@ func (r *repository) GetInvitesByReceiverCount(ctx context.Context, uid string)
 
 func (r *repository) GetInvitesByMeeting(ctx context.Context, mid string) ([]*domain.Invite, error) {
 	var i []*domain.Invite
-	c, err := r.col.Find(ctx, bson.D{primitive.E{Key: "meeting_id", Value: mid}})
+	c, err := r.col.Find(ctx, pending(bson.M{"meeting_id": mid}))
 	if err != nil {
+		if database.IsTransient(err) {
+			return nil, domain.ErrConflict
+		}
 		sentry.CaptureException(err)
 		zap.L().Error("failed to find invites by meeting", zap.String("id", mid), zap.Error(err))
 		return nil, domain.ErrInternal
@@ -126,8 +171,11 @@ func (r *repository) GetInvitesByMeeting(ctx context.Context, mid string) ([]*do
 }
 
 func (r *repository) GetInvitesByMeetingCount(ctx context.Context, mid string) (int64, error) {
-	c, err := r.col.CountDocuments(ctx, bson.D{primitive.E{Key: "meeting_id", Value: mid}})
+	c, err := r.col.CountDocuments(ctx, pending(bson.M{"meeting_id": mid}))
 	if err != nil {
+		if database.IsTransient(err) {
+			return -1, domain.ErrConflict
+		}
 		sentry.CaptureException(err)
 		zap.L().Error("failed to find invite count by meeting", zap.String("id", mid), zap.Error(err))
 		return -1, domain.ErrInternal
@@ -135,6 +183,43 @@ func (r *repository) GetInvitesByMeetingCount(ctx context.Context, mid string) (
 	return c, nil
 }
 
+func (r *repository) GetInviteHistoryByReceiver(ctx context.Context, uid string) ([]*domain.Invite, error) {
+	return r.find(ctx, bson.M{"receiver_id": uid})
+}
+
+func (r *repository) GetInviteHistoryByMeeting(ctx context.Context, mid string) ([]*domain.Invite, error) {
+	return r.find(ctx, bson.M{"meeting_id": mid})
+}
+
+func (r *repository) GetExpiredInvites(ctx context.Context) ([]*domain.Invite, error) {
+	return r.find(ctx, unresolved(bson.M{"expires_at": bson.M{"$lte": time.Now()}}))
+}
+
+func (r *repository) ResolveInvite(ctx context.Context, id string, status string) error {
+	// Expired invites are not pending anymore, they only must not be resolved already
+	filter := pending(bson.M{"_id": id})
+	if status == domain.InviteStatusExpired {
+		filter = unresolved(bson.M{"_id": id})
+	}
+	res, err := r.col.UpdateOne(ctx, filter, bson.M{"$set": bson.M{
+		"status":      status,
+		"resolved_at": time.Now(),
+	}})
+	if err != nil {
+		if database.IsTransient(err) {
+			return domain.ErrConflict
+		}
+		sentry.CaptureException(err)
+		zap.L().Error("failed to resolve invite", zap.String("id", id), zap.String("status", status), zap.Error(err))
+		return domain.ErrInternal
+	}
+	if res.MatchedCount == 0 {
+		return domain.ErrNotFound
+	}
+	zap.L().Info("resolved invite", zap.String("id", id), zap.String("status", status))
+	return nil
+}
+
 func (r *repository) DeleteInvite(ctx context.Context, id string) error {
 	_, err := r.col.DeleteOne(ctx, bson.D{primitive.E{Key: "_id", Value: id}})
 	if err != nil {
@@ -145,3 +230,61 @@ func (r *repository) DeleteInvite(ctx context.Context, id string) error {
 	zap.L().Info("deleted invite", zap.String("id", id))
 	return nil
 }
+
+func (r *repository) DeleteInvitesByMeeting(ctx context.Context, mid string) error {
+	res, err := r.col.DeleteMany(ctx, bson.M{"meeting_id": mid})
+	if err != nil {
+		if database.IsTransient(err) {
+			return domain.ErrConflict
+		}
+		sentry.CaptureException(err)
+		zap.L().Error("failed to delete invites by meeting", zap.String("id", mid), zap.Error(err))
+		return domain.ErrInternal
+	}
+	zap.L().Info("deleted invites by meeting", zap.String("id", mid), zap.Int64("count", res.DeletedCount))
+	return nil
+}
+
+// find returns all invites matching the filter
+func (r *repository) find(ctx context.Context, filter bson.M) ([]*domain.Invite, error) {
+	var i []*domain.Invite
+	c, err := r.col.Find(ctx, filter, options.Find().SetSort(bson.M{"timestamp": -1}))
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to find invites", zap.Any("filter", filter), zap.Error(err))
+		return nil, domain.ErrInternal
+	}
+	err = c.All(ctx, &i)
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to parse invite elements from cursor in slice", zap.Error(err))
+		return nil, domain.ErrInternal
+	}
+	if i == nil {
+		i = make([]*domain.Invite, 0)
+	}
+	return i, nil
+}
+
+// pending restricts the filter to pending invites which are not expired yet.
+// Invites created before the status was introduced have no status and never expire.
+func pending(filter bson.M) bson.M {
+	filter = unresolved(filter)
+	filter["$or"] = bson.A{
+		bson.M{"expires_at": bson.M{"$gt": time.Now()}},
+		bson.M{"expires_at": nil},
+	}
+	return filter
+}
+
+// visible restricts the filter to invites which are not suppressed, so the receiver may see them
+func visible(filter bson.M) bson.M {
+	filter["suppressed"] = bson.M{"$ne": true}
+	return filter
+}
+
+// unresolved restricts the filter to invites which were not resolved yet, including expired ones
+func unresolved(filter bson.M) bson.M {
+	filter["status"] = bson.M{"$in": bson.A{domain.InviteStatusPending, nil}}
+	return filter
+}
@@ -20,6 +20,7 @@ package invite
 
 import (
 	"context"
+	"errors"
 	"github.com/google/uuid"
 	"github.com/hearky/server/pkg/domain"
 	"time"
@@ -29,14 +30,24 @@ type service struct {
 	inviteRepo  domain.InviteRepository
 	meetingRepo domain.MeetingRepository
 	userRepo    domain.UserRepository
+	friendRepo  domain.FriendshipRepository
+	blockRepo   domain.BlockRepository
+	events      domain.EventBus
+	tx          domain.Transactor
 }
 
-func NewService(inviteRepository domain.InviteRepository, meetingRepository domain.MeetingRepository, userRepository domain.UserRepository) domain.InviteService {
-	return &service{
+func NewService(inviteRepository domain.InviteRepository, meetingRepository domain.MeetingRepository, userRepository domain.UserRepository, friendshipRepository domain.FriendshipRepository, blockRepository domain.BlockRepository, eventBus domain.EventBus, transactor domain.Transactor) domain.InviteService {
+	s := &service{
 		inviteRepo:  inviteRepository,
 		meetingRepo: meetingRepository,
 		userRepo:    userRepository,
+		friendRepo:  friendshipRepository,
+		blockRepo:   blockRepository,
+		events:      eventBus,
+		tx:          transactor,
 	}
+	go s.sweep()
+	return s
 }
 
 func (s *service) SendInvite(dto *domain.CreateInviteDto, uid string) error {
@@ -44,35 +55,198 @@ func (s *service) SendInvite(dto *domain.CreateInviteDto, uid string) error {
 	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
 	defer ccl()
 
-	// Check if the exact invite already exists
-	_, err := s.inviteRepo.GetInviteByReceiverAndMeeting(ctx, dto.ReceiverID, dto.MeetingID)
-	if err != nil && err != domain.ErrNotFound {
+	// Check if meeting exists
+	m, err := s.meetingRepo.GetMeetingByID(ctx, dto.MeetingID)
+	if err != nil {
 		return err
-	} else if err != domain.ErrNotFound {
-		return domain.ErrInviteExists
+	}
+
+	// Check if user is organizer
+	if !m.IsOrganizer(uid) {
+		return domain.ErrForbidden
+	}
+
+	// Find receiver
+	u, err := s.receiver(ctx, dto.ReceiverID, dto.Username)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.invite(ctx, m, uid, u)
+	return err
+}
+
+func (s *service) SendInvites(dto *domain.CreateInvitesDto, uid string) ([]*domain.InviteResult, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 20*time.Second)
+	defer ccl()
+
+	if len(dto.ReceiverIDs)+len(dto.Usernames) > domain.MaxBulkInvites {
+		return nil, domain.ErrInvalidInput
 	}
 
 	// Check if meeting exists
 	m, err := s.meetingRepo.GetMeetingByID(ctx, dto.MeetingID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Check if user is organizer
 	if !m.IsOrganizer(uid) {
-		return domain.ErrForbidden
+		return nil, domain.ErrForbidden
+	}
+
+	// Invite every receiver, failures are reported per receiver.
+	// A user passed multiple times, e.g. by id and username, gets the result of their first invite.
+	rs := make([]*domain.InviteResult, 0, len(dto.ReceiverIDs)+len(dto.Usernames))
+	invited := make(map[string]*domain.InviteResult)
+	send := func(r *domain.InviteResult) {
+		u, err := s.receiver(ctx, r.ReceiverID, r.Username)
+		if err != nil {
+			r.Error = err.Error()
+			return
+		}
+		if prev, ok := invited[u.ID]; ok {
+			r.Invite, r.Error, r.Limit, r.Remaining = prev.Invite, prev.Error, prev.Limit, prev.Remaining
+			return
+		}
+		invited[u.ID] = r
+		r.Invite, err = s.invite(ctx, m, uid, u)
+		if err != nil {
+			r.Error = err.Error()
+		}
+		var le *domain.LimitError
+		if errors.As(err, &le) {
+			r.Limit, r.Remaining = le.Limit, &le.Remaining
+		}
+	}
+	for _, id := range dto.ReceiverIDs {
+		r := &domain.InviteResult{ReceiverID: id}
+		send(r)
+		rs = append(rs, r)
+	}
+	for _, n := range dto.Usernames {
+		r := &domain.InviteResult{Username: n}
+		send(r)
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+// receiver finds the user to invite by their id or, if no id is passed, by their username
+func (s *service) receiver(ctx context.Context, id string, username string) (*domain.User, error) {
+	if id != "" {
+		return s.userRepo.GetUserByID(ctx, id)
+	}
+	if username != "" {
+		return s.userRepo.GetUserByUsername(ctx, username)
+	}
+	return nil, domain.ErrInvalidInput
+}
+
+// remainingInvites returns how many more pending invites the meeting may have
+func (s *service) remainingInvites(ctx context.Context, m *domain.Meeting) (int, error) {
+	c, err := s.inviteRepo.GetInvitesByMeetingCount(ctx, m.ID)
+	if err != nil {
+		return 0, err
+	}
+	if r := m.Upgrade.ConcurrentInvites - int(c); r > 0 {
+		return r, nil
+	}
+	return 0, nil
+}
+
+// invite creates an invite from the organizer uid for the user u, if they can be invited to the meeting
+func (s *service) invite(ctx context.Context, m *domain.Meeting, uid string, u *domain.User) (*domain.Invite, error) {
+	// Check if the receiver is a member or banned
+	if m.IsParticipant(u.ID) {
+		return nil, domain.ErrAlreadyMember
+	}
+	if m.IsBanned(u.ID) {
+		return nil, domain.ErrUserBanned
+	}
+
+	// Check if the receiver only accepts invites from friends
+	if u.Settings.FriendsOnlyInvites {
+		f, err := s.friendRepo.GetFriendship(ctx, uid, u.ID)
+		if err != nil && err != domain.ErrNotFound {
+			return nil, err
+		} else if err == domain.ErrNotFound || !f.IsAccepted() {
+			return nil, domain.ErrNotFriends
+		}
+	}
+
+	// Check the limit and create the invite at once, locking the meeting makes concurrent invites conflict,
+	// so they are retried and can not exceed the limit together
+	var i *domain.Invite
+	err := domain.RetryOnConflict(func() error {
+		return s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			i, err = s.createInvite(ctx, m, uid, u)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Notify organizers and the receiver, unless the invite is suppressed
+	s.events.Publish(&domain.Event{
+		Type:    domain.EventInviteCreate,
+		UserIDs: i.RecipientIDs(m.OrganizerIDs()),
+		Data:    i,
+	})
+	return i, nil
+}
+
+// createInvite checks if the meeting has invites left and creates the invite, it has to run in a transaction
+func (s *service) createInvite(ctx context.Context, m *domain.Meeting, uid string, u *domain.User) (*domain.Invite, error) {
+	err := s.meetingRepo.LockMeeting(ctx, m.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if the exact invite already exists
+	_, err = s.inviteRepo.GetInviteByReceiverAndMeeting(ctx, u.ID, m.ID)
+	if err != nil && err != domain.ErrNotFound {
+		return nil, err
+	} else if err != domain.ErrNotFound {
+		return nil, domain.ErrInviteExists
+	}
+
+	// Check if the meeting has invites left
+	remaining, err := s.remainingInvites(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	if remaining == 0 {
+		return nil, &domain.LimitError{Err: domain.ErrTooManyInvites, Limit: m.Upgrade.ConcurrentInvites, Remaining: remaining}
 	}
 
-	// Create new invite
-	id := uuid.New().String()
 	i := &domain.Invite{
-		ID:         id,
+		ID:         uuid.New().String(),
 		SenderID:   uid,
-		ReceiverID: dto.ReceiverID,
-		MeetingID:  dto.MeetingID,
+		ReceiverID: u.ID,
+		MeetingID:  m.ID,
 		Timestamp:  time.Now(),
+		Status:     domain.InviteStatusPending,
+		ExpiresAt:  time.Now().Add(domain.InviteLifetime),
+	}
+
+	// Suppress the invite if the receiver blocked the sender. It is stored like any other invite,
+	// so the sender does not learn about the block, but the receiver never sees it.
+	blocked, err := s.blockRepo.IsBlocked(ctx, u.ID, uid)
+	if err != nil {
+		return nil, err
 	}
-	return s.inviteRepo.CreateInvite(ctx, i)
+	i.Suppressed = blocked
+
+	// Create new invite
+	err = s.inviteRepo.CreateInvite(ctx, i)
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
 }
 
 func (s *service) GetInvitesByReceiver(uid string) ([]*domain.Invite, error) {
@@ -149,6 +323,30 @@ func (s *service) GetInvitesByMeetingCount(mid string, uid string) (int64, error
 	return c, nil
 }
 
+func (s *service) GetInviteHistoryByMeeting(mid string, uid string) ([]*domain.Invite, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Fetch meeting
+	m, err := s.meetingRepo.GetMeetingByID(ctx, mid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check permissions
+	if !m.IsOrganizer(uid) {
+		return nil, domain.ErrForbidden
+	}
+
+	// Fetch invites
+	i, err := s.inviteRepo.GetInviteHistoryByMeeting(ctx, mid)
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
 func (s *service) AcceptInvite(id string, uid string) error {
 	// Define timeout
 	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
@@ -164,31 +362,83 @@ func (s *service) AcceptInvite(id string, uid string) error {
 	if i.ReceiverID != uid {
 		return domain.ErrForbidden
 	}
+	if !i.IsPending() || i.Suppressed {
+		return domain.ErrNotFound
+	}
 
-	// Fetch meeting, if it does not exist -> delete invite
+	// Fetch meeting, if it does not exist -> revoke invite
 	m, err := s.meetingRepo.GetMeetingByID(ctx, i.MeetingID)
 	if err != nil {
-		return s.inviteRepo.DeleteInvite(ctx, id)
+		return s.resolveInvite(ctx, i, nil, domain.InviteStatusRevoked)
 	}
 
-	// Check if user still exists, if not -> delete invite
+	// Check if user still exists and is not banned, if not -> revoke invite
 	_, err = s.userRepo.GetUserByID(ctx, i.ReceiverID)
 	if err != nil {
-		return s.inviteRepo.DeleteInvite(ctx, id)
+		return s.resolveInvite(ctx, i, m, domain.InviteStatusRevoked)
+	}
+	if m.IsBanned(i.ReceiverID) {
+		_ = s.resolveInvite(ctx, i, m, domain.InviteStatusRevoked)
+		return domain.ErrUserBanned
 	}
 
-	// Add invited user as a participant to the meeting
+	// Add invited user as a participant to the meeting and accept the invite at once,
+	// this fails if the meeting is full. Both writes are idempotent, so a conflicting transaction can be retried.
+	err = domain.RetryOnConflict(func() error {
+		return s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+			err := s.meetingRepo.AddParticipant(ctx, m.ID, i.ReceiverID)
+			if err != nil {
+				return err
+			}
+			return s.inviteRepo.ResolveInvite(ctx, i.ID, domain.InviteStatusAccepted)
+		})
+	})
+	if err != nil {
+		return err
+	}
 	m.AddParticipant(i.ReceiverID)
-	err = s.meetingRepo.SaveMeeting(ctx, m)
+	i.Status = domain.InviteStatusAccepted
+
+	s.events.Publish(&domain.Event{
+		Type:    domain.EventInviteDelete,
+		UserIDs: i.RecipientIDs(m.OrganizerIDs()),
+		Data:    i,
+	})
+
+	// Notify all members about the new participant
+	s.events.Publish(&domain.Event{
+		Type:    domain.EventMeetingParticipantAdd,
+		UserIDs: m.MemberIDs(),
+		Data:    &domain.ParticipantEvent{MeetingID: m.ID, UserID: i.ReceiverID},
+	})
+	return nil
+}
+
+func (s *service) DeclineInvite(id string, uid string) error {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Check if invite exists
+	i, err := s.inviteRepo.GetInviteByID(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	// Delete invite
-	return s.inviteRepo.DeleteInvite(ctx, id)
+	// Check if the current user is the receiver
+	if i.ReceiverID != uid {
+		return domain.ErrForbidden
+	}
+	if !i.IsPending() || i.Suppressed {
+		return domain.ErrNotFound
+	}
+
+	// Decline invite, the organizers are only notified if the meeting still exists
+	m, _ := s.meetingRepo.GetMeetingByID(ctx, i.MeetingID)
+	return s.resolveInvite(ctx, i, m, domain.InviteStatusDeclined)
 }
 
-func (s *service) DeleteInvite(id string, uid string) error {
+func (s *service) RevokeInvite(id string, uid string) error {
 	// Define timeout
 	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
 	defer ccl()
@@ -199,22 +449,67 @@ func (s *service) DeleteInvite(id string, uid string) error {
 		return err
 	}
 
-	// Fetch meeting, if it does not exist -> delete invite
+	// Fetch meeting
 	m, err := s.meetingRepo.GetMeetingByID(ctx, i.MeetingID)
 	if err != nil {
-		return s.inviteRepo.DeleteInvite(ctx, id)
-	}
-
-	// If sender is not an organizer anymore -> delete invite
-	if !m.IsOrganizer(i.SenderID) {
-		return s.inviteRepo.DeleteInvite(ctx, id)
+		return err
 	}
 
 	// Check if current user is an organizer
-	if !m.IsOrganizer(uid) && i.ReceiverID != uid {
+	if !m.IsOrganizer(uid) {
 		return domain.ErrForbidden
 	}
+	if !i.IsPending() {
+		return domain.ErrNotFound
+	}
+
+	// Revoke invite
+	return s.resolveInvite(ctx, i, m, domain.InviteStatusRevoked)
+}
+
+// resolveInvite changes the status of the invite and notifies the receiver and the organizers of the meeting, if it still exists
+func (s *service) resolveInvite(ctx context.Context, i *domain.Invite, m *domain.Meeting, status string) error {
+	err := s.inviteRepo.ResolveInvite(ctx, i.ID, status)
+	if err != nil {
+		return err
+	}
+	i.Status = status
+
+	var organizers []string
+	if m != nil {
+		organizers = m.OrganizerIDs()
+	}
+	s.events.Publish(&domain.Event{
+		Type:    domain.EventInviteDelete,
+		UserIDs: i.RecipientIDs(organizers),
+		Data:    i,
+	})
+	return nil
+}
+
+// sweep periodically expires all pending invites which are older than their lifetime
+func (s *service) sweep() {
+	t := time.NewTicker(time.Minute)
+	defer t.Stop()
+	for range t.C {
+		s.expireInvites()
+	}
+}
+
+func (s *service) expireInvites() {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 30*time.Second)
+	defer ccl()
 
-	// Delete invite
-	return s.inviteRepo.DeleteInvite(ctx, id)
+	// Fetch expired invites
+	is, err := s.inviteRepo.GetExpiredInvites(ctx)
+	if err != nil {
+		return
+	}
+
+	// Resolving fails if another instance expired the invite already
+	for _, i := range is {
+		m, _ := s.meetingRepo.GetMeetingByID(ctx, i.MeetingID)
+		_ = s.resolveInvite(ctx, i, m, domain.InviteStatusExpired)
+	}
 }
@@ -21,6 +21,7 @@ package meeting
 import (
 	"context"
 	"github.com/getsentry/sentry-go"
+	"github.com/hearky/server/pkg/database"
 	"github.com/hearky/server/pkg/domain"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -103,6 +104,9 @@ func (r *repository) GetMeetingsByUserCount(ctx context.Context, id string) (int
 func (r *repository) DeleteMeeting(ctx context.Context, id string) error {
 	_, err := r.col.DeleteOne(ctx, bson.D{primitive.E{Key: "_id", Value: id}})
 	if err != nil {
+		if database.IsTransient(err) {
+			return domain.ErrConflict
+		}
 		sentry.CaptureException(err)
 		zap.L().Error("failed to delete meeting", zap.Any("id", id), zap.Error(err))
 		return domain.ErrInternal
@@ -112,19 +116,133 @@ func (r *repository) DeleteMeeting(ctx context.Context, id string) error {
 }
 
 func (r *repository) SaveMeeting(ctx context.Context, m *domain.Meeting) error {
-	_, err := r.col.UpdateByID(ctx, m.ID, bson.D{
-		{"$set", bson.D{
-			{"name", m.Name},
-			{"owner_id", m.OwnerID},
-			{"participants", m.Participants},
-			{"organizers", m.Organizers},
-			{"upgrade", m.Upgrade},
-		}},
+	res, err := r.col.UpdateOne(ctx, versionFilter(m.ID, m.Version), bson.M{
+		"$set": bson.M{
+			"name":         m.Name,
+			"description":  m.Description,
+			"topic":        m.Topic,
+			"owner_id":     m.OwnerID,
+			"participants": m.Participants,
+			"organizers":   m.Organizers,
+			"banned":       m.Banned,
+			"settings":     m.Settings,
+			"upgrade":      m.Upgrade,
+		},
+		"$inc": bson.M{"version": 1},
 	})
 	if err != nil {
 		sentry.CaptureException(err)
 		zap.L().Error("failed to update meeting", zap.Any("meeting", m), zap.Error(err))
 		return domain.ErrInternal
 	}
+	if res.MatchedCount == 0 {
+		return domain.ErrConflict
+	}
+	m.Version++
+	return nil
+}
+
+// AddParticipant adds the user to the participants of the meeting in a single write.
+// It fails with domain.ErrMeetingFull if the participant limit of the meeting's upgrade is reached
+// and with domain.ErrUserBanned if the user is banned from the meeting.
+func (r *repository) AddParticipant(ctx context.Context, id string, uid string) error {
+	res, err := r.col.UpdateOne(ctx, bson.M{
+		"_id":          id,
+		"owner_id":     bson.M{"$ne": uid},
+		"participants": bson.M{"$ne": uid},
+		"banned":       bson.M{"$ne": uid},
+		"$expr": bson.M{"$lt": bson.A{
+			bson.M{"$size": bson.M{"$ifNull": bson.A{"$participants", bson.A{}}}},
+			"$upgrade.participants",
+		}},
+	}, bson.A{bson.M{"$set": bson.M{
+		"participants": bson.M{"$concatArrays": bson.A{orEmpty("$participants"), bson.A{bson.M{"$literal": uid}}}},
+		"version":      incVersion,
+	}}})
+	if err != nil {
+		if database.IsTransient(err) {
+			return domain.ErrConflict
+		}
+		sentry.CaptureException(err)
+		zap.L().Error("failed to add participant to meeting", zap.String("id", id), zap.String("user", uid), zap.Error(err))
+		return domain.ErrInternal
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+
+	// Find out why the meeting did not match
+	m, err := r.GetMeetingByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if m.IsParticipant(uid) {
+		return nil
+	}
+	if m.IsBanned(uid) {
+		return domain.ErrUserBanned
+	}
+	return domain.ErrMeetingFull
+}
+
+func (r *repository) LockMeeting(ctx context.Context, id string) error {
+	res, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$inc": bson.M{"lock": 1}})
+	if err != nil {
+		if database.IsTransient(err) {
+			return domain.ErrConflict
+		}
+		sentry.CaptureException(err)
+		zap.L().Error("failed to lock meeting", zap.String("id", id), zap.Error(err))
+		return domain.ErrInternal
+	}
+	if res.MatchedCount == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// RemoveParticipant removes the user from the participants and organizers of the meeting in a single write
+func (r *repository) RemoveParticipant(ctx context.Context, id string, uid string) error {
+	res, err := r.col.UpdateOne(ctx, bson.M{"_id": id, "participants": uid}, bson.A{bson.M{"$set": bson.M{
+		"participants": without("$participants", uid),
+		"organizers":   without("$organizers", uid),
+		"version":      incVersion,
+	}}})
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to remove participant from meeting", zap.String("id", id), zap.String("user", uid), zap.Error(err))
+		return domain.ErrInternal
+	}
+	if res.MatchedCount == 0 {
+		return domain.ErrNotFound
+	}
 	return nil
 }
+
+// Meetings created before the participant updates were atomic may store null instead of empty lists,
+// so the updates use pipelines which treat null as an empty list instead of $addToSet and $pull
+
+// incVersion increments the version of the meeting within an update pipeline
+var incVersion = bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", 0}}, 1}}
+
+// orEmpty evaluates to the list in the passed field or an empty list if the field is null
+func orEmpty(field string) bson.M {
+	return bson.M{"$ifNull": bson.A{field, bson.A{}}}
+}
+
+// without evaluates to the list in the passed field without the user
+func without(field string, uid string) bson.M {
+	return bson.M{"$filter": bson.M{
+		"input": orEmpty(field),
+		"cond":  bson.M{"$ne": bson.A{"$$this", bson.M{"$literal": uid}}},
+	}}
+}
+
+// versionFilter matches the meeting only if it still has the passed version,
+// meetings created before versioning have no version field which equals version 0
+func versionFilter(id string, version int64) bson.M {
+	if version == 0 {
+		return bson.M{"_id": id, "version": bson.M{"$in": bson.A{0, nil}}}
+	}
+	return bson.M{"_id": id, "version": version}
+}
@@ -20,50 +20,72 @@ package meeting
 
 import (
 	"context"
+	"errors"
 	"github.com/google/uuid"
 	"github.com/hearky/server/pkg/domain"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type service struct {
-	meetingRepo domain.MeetingRepository
-	inviteRepo  domain.InviteRepository
-	userRepo    domain.UserRepository
+	meetingRepo   domain.MeetingRepository
+	inviteRepo    domain.InviteRepository
+	userRepo      domain.UserRepository
+	inviteService domain.InviteService
+	audit         domain.AuditService
+	events        domain.EventBus
+	tx            domain.Transactor
 }
 
-func NewService(meetingRepository domain.MeetingRepository, inviteRepository domain.InviteRepository, userRepository domain.UserRepository) domain.MeetingService {
+func NewService(meetingRepository domain.MeetingRepository, inviteRepository domain.InviteRepository, userRepository domain.UserRepository, inviteService domain.InviteService, auditService domain.AuditService, eventBus domain.EventBus, transactor domain.Transactor) domain.MeetingService {
 	return &service{
-		meetingRepo: meetingRepository,
-		inviteRepo:  inviteRepository,
-		userRepo:    userRepository,
+		meetingRepo:   meetingRepository,
+		inviteRepo:    inviteRepository,
+		userRepo:      userRepository,
+		inviteService: inviteService,
+		audit:         auditService,
+		events:        eventBus,
+		tx:            transactor,
 	}
 }
 
-func (s *service) CreateMeeting(dto *domain.CreateMeetingDto, uid string) (string, error) {
+func (s *service) CreateMeeting(dto *domain.CreateMeetingDto, uid string) (*domain.CreateMeetingResult, error) {
 	// Define timeout
 	ctx, ccl := context.WithTimeout(context.Background(), 20*time.Second)
 	defer ccl()
 
 	u, err := s.userRepo.GetUserByID(ctx, uid)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	ms, err := s.meetingRepo.GetMeetingsByUserCount(ctx, uid)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if ms+1 > int64(u.Upgrade.ConcurrentMeetings) {
-		return "", domain.ErrTooManyMeetings
+		return nil, domain.ErrTooManyMeetings
+	}
+	if len(dto.Participants)+len(dto.Usernames) > domain.MaxBulkInvites {
+		return nil, domain.ErrInvalidInput
+	}
+	name := strings.TrimSpace(dto.Name)
+	if !validName(name) {
+		return nil, domain.ErrInvalidInput
 	}
 
 	// Create meeting
 	id := uuid.New().String()
 	m := &domain.Meeting{
 		ID:      id,
-		Name:    dto.Name,
+		Name:    name,
 		OwnerID: uid,
+		// Store empty lists instead of null, so they can be updated atomically
+		Organizers:   []string{},
+		Participants: []string{},
+		Banned:       []string{},
 		Upgrade: domain.MeetingUpgrade{
 			Participants:      domain.MaxParticipantsFree,
 			ConcurrentInvites: domain.MaxConcurrentInvitesFree,
@@ -71,29 +93,24 @@ func (s *service) CreateMeeting(dto *domain.CreateMeetingDto, uid string) (strin
 	}
 	err = s.meetingRepo.CreateMeeting(ctx, m)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	// Invite all participants
-	if len(dto.Participants) > domain.MaxConcurrentInvitesFree {
-		dto.Participants = dto.Participants[0 : domain.MaxConcurrentInvitesFree-1]
-	}
-	for _, p := range dto.Participants {
-		// TODO: Check if they are friends
-		_, err := s.userRepo.GetUserByID(ctx, p)
+	// Invite all participants, the meeting exists already, so a failure is reported per receiver
+	// instead of failing the request, which would make the client create the meeting again
+	res := &domain.CreateMeetingResult{ID: id, Invites: make([]*domain.InviteResult, 0)}
+	if len(dto.Participants)+len(dto.Usernames) > 0 {
+		res.Invites, err = s.inviteService.SendInvites(&domain.CreateInvitesDto{
+			ReceiverIDs: dto.Participants,
+			Usernames:   dto.Usernames,
+			MeetingID:   id,
+		}, uid)
 		if err != nil {
-			continue
+			res.Invites = failedInvites(dto, err)
 		}
-		_ = s.inviteRepo.CreateInvite(ctx, &domain.Invite{
-			ID:         uuid.New().String(),
-			SenderID:   uid,
-			ReceiverID: p,
-			MeetingID:  m.ID,
-			Timestamp:  time.Now(),
-		})
 	}
 
-	return id, nil
+	return res, nil
 }
 
 func (s *service) GetMeetingByID(mid string, uid string) (*domain.Meeting, error) {
@@ -107,11 +124,85 @@ func (s *service) GetMeetingByID(mid string, uid string) (*domain.Meeting, error
 		return nil, err
 	}
 
-	// Check permissions
+	// Check permissions, moderators and admins can read every meeting
 	if !m.IsParticipant(uid) {
-		return nil, domain.ErrForbidden
+		e, err := s.audit.Override(ctx, uid, domain.PermissionReadMeetings, domain.AuditActionReadMeeting, m.ID)
+		if err != nil {
+			return nil, err
+		}
+		s.audit.Complete(e, nil)
+	}
+
+	return m, nil
+}
+
+func (s *service) UpdateMeeting(mid string, dto *domain.UpdateMeetingDto, uid string) (*domain.Meeting, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	apply := func(m *domain.Meeting) error {
+		// Check permissions
+		if !m.IsOrganizer(uid) {
+			return domain.ErrForbidden
+		}
+
+		// Validate and apply changes, only the passed fields are validated,
+		// so meetings stored before the validation can still be changed otherwise
+		if dto.Name != nil {
+			name := strings.TrimSpace(*dto.Name)
+			if !validName(name) {
+				return domain.ErrInvalidInput
+			}
+			m.Name = name
+		}
+		if dto.Description != nil {
+			description := strings.TrimSpace(*dto.Description)
+			if utf8.RuneCountInString(description) > domain.MaxMeetingDescriptionLength {
+				return domain.ErrInvalidInput
+			}
+			m.Description = description
+		}
+		if dto.Topic != nil {
+			topic := strings.TrimSpace(*dto.Topic)
+			if utf8.RuneCountInString(topic) > domain.MaxMeetingTopicLength {
+				return domain.ErrInvalidInput
+			}
+			m.Topic = topic
+		}
+		if dto.Settings != nil && dto.Settings.MuteOnJoin != nil {
+			m.Settings.MuteOnJoin = *dto.Settings.MuteOnJoin
+		}
+		return nil
 	}
 
+	var m *domain.Meeting
+	var err error
+	if dto.Version != nil {
+		// The client edited a specific version, so a conflict must not be retried
+		m, err = s.meetingRepo.GetMeetingByID(ctx, mid)
+		if err != nil {
+			return nil, err
+		}
+		if m.Version != *dto.Version {
+			return nil, domain.ErrConflict
+		}
+		if err := apply(m); err != nil {
+			return nil, err
+		}
+		err = s.meetingRepo.SaveMeeting(ctx, m)
+	} else {
+		m, err = s.modifyMeeting(ctx, mid, apply)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.events.Publish(&domain.Event{
+		Type:    domain.EventMeetingUpdate,
+		UserIDs: m.MemberIDs(),
+		Data:    m,
+	})
 	return m, nil
 }
 
@@ -154,17 +245,331 @@ func (s *service) DeleteMeeting(mid string, uid string) error {
 		return err
 	}
 
-	// Check permissions
+	// Check permissions, admins can delete every meeting
+	var e *domain.AuditEntry
 	if !m.IsOwner(uid) {
-		return domain.ErrForbidden
+		e, err = s.audit.Override(ctx, uid, domain.PermissionDeleteMeetings, domain.AuditActionDeleteMeeting, m.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.deleteMeeting(ctx, m)
+	s.audit.Complete(e, err)
+	return err
+}
+
+// deleteMeeting deletes the meeting with all its invites and notifies the members
+func (s *service) deleteMeeting(ctx context.Context, m *domain.Meeting) error {
+	// Delete all invites and the meeting at once
+	mid := m.ID
+	var is []*domain.Invite
+	err := domain.RetryOnConflict(func() error {
+		return s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			is, err = s.inviteRepo.GetInvitesByMeeting(ctx, mid)
+			if err != nil {
+				return err
+			}
+			err = s.inviteRepo.DeleteInvitesByMeeting(ctx, mid)
+			if err != nil {
+				return err
+			}
+			return s.meetingRepo.DeleteMeeting(ctx, mid)
+		})
+	})
+	if err != nil {
+		return err
 	}
 
-	// Delete all invites
-	is, err := s.inviteRepo.GetInvitesByMeeting(ctx, mid)
 	for _, i := range is {
-		_ = s.inviteRepo.DeleteInvite(ctx, i.ID)
+		if i.Suppressed {
+			continue
+		}
+		s.events.Publish(&domain.Event{
+			Type:    domain.EventInviteDelete,
+			UserIDs: []string{i.ReceiverID},
+			Data:    i,
+		})
+	}
+
+	// Notify all members
+	s.events.Publish(&domain.Event{
+		Type:    domain.EventMeetingDelete,
+		UserIDs: m.MemberIDs(),
+		Data:    &domain.IDMessage{ID: m.ID},
+	})
+	return nil
+}
+
+func (s *service) LeaveMeeting(mid string, uid string) error {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Fetch meeting
+	m, err := s.meetingRepo.GetMeetingByID(ctx, mid)
+	if err != nil {
+		return err
+	}
+
+	// The owner has to transfer the ownership first
+	if m.IsOwner(uid) {
+		return domain.ErrOwnerOfMeeting
 	}
+	if !m.IsParticipant(uid) {
+		return domain.ErrNotFound
+	}
+
+	// Remove participant
+	err = s.meetingRepo.RemoveParticipant(ctx, mid, uid)
+	if err != nil {
+		return err
+	}
+
+	// Notify all members including the leaving one
+	s.events.Publish(&domain.Event{
+		Type:    domain.EventMeetingParticipantRemove,
+		UserIDs: m.MemberIDs(),
+		Data:    &domain.ParticipantEvent{MeetingID: m.ID, UserID: uid},
+	})
+	return nil
+}
+
+func (s *service) RemoveParticipant(mid string, target string, uid string) error {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Fetch meeting
+	m, err := s.meetingRepo.GetMeetingByID(ctx, mid)
+	if err != nil {
+		return err
+	}
+
+	// Check permissions
+	if !m.IsParticipant(target) {
+		return domain.ErrNotFound
+	}
+	if !m.CanModerate(uid, target) {
+		return domain.ErrForbidden
+	}
+
+	// Remove participant
+	err = s.meetingRepo.RemoveParticipant(ctx, mid, target)
+	if err != nil {
+		return err
+	}
+
+	// Notify all members including the removed one
+	s.events.Publish(&domain.Event{
+		Type:    domain.EventMeetingParticipantRemove,
+		UserIDs: m.MemberIDs(),
+		Data:    &domain.ParticipantEvent{MeetingID: m.ID, UserID: target},
+	})
+	return nil
+}
+
+func (s *service) BanUser(mid string, target string, uid string) error {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	var wasMember bool
+	var members []string
+	m, err := s.modifyMeeting(ctx, mid, func(m *domain.Meeting) error {
+		// Check permissions
+		if !m.CanModerate(uid, target) {
+			return domain.ErrForbidden
+		}
+		if m.IsBanned(target) {
+			return errUnchanged
+		}
+
+		// Remove user from the meeting and ban them
+		wasMember = m.IsParticipant(target)
+		members = m.MemberIDs()
+		m.RemoveParticipant(target)
+		m.Ban(target)
+		return nil
+	})
+	if err == errUnchanged {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// Revoke the pending invite of the banned user
+	i, err := s.inviteRepo.GetInviteByReceiverAndMeeting(ctx, target, mid)
+	if err == nil && s.inviteRepo.ResolveInvite(ctx, i.ID, domain.InviteStatusRevoked) == nil {
+		i.Status = domain.InviteStatusRevoked
+		s.events.Publish(&domain.Event{
+			Type:    domain.EventInviteDelete,
+			UserIDs: i.RecipientIDs(m.OrganizerIDs()),
+			Data:    i,
+		})
+	}
+
+	// Notify members and the banned user
+	if wasMember {
+		s.events.Publish(&domain.Event{
+			Type:    domain.EventMeetingParticipantRemove,
+			UserIDs: members,
+			Data:    &domain.ParticipantEvent{MeetingID: m.ID, UserID: target},
+		})
+	}
+	s.events.Publish(&domain.Event{
+		Type:    domain.EventMeetingBanAdd,
+		UserIDs: append(m.OrganizerIDs(), target),
+		Data:    &domain.ParticipantEvent{MeetingID: m.ID, UserID: target},
+	})
+	return nil
+}
+
+func (s *service) UnbanUser(mid string, target string, uid string) error {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	m, err := s.modifyMeeting(ctx, mid, func(m *domain.Meeting) error {
+		// Check permissions
+		if !m.IsOrganizer(uid) {
+			return domain.ErrForbidden
+		}
+		if !m.IsBanned(target) {
+			return domain.ErrNotFound
+		}
+
+		// Unban user
+		m.Unban(target)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.events.Publish(&domain.Event{
+		Type:    domain.EventMeetingBanRemove,
+		UserIDs: append(m.OrganizerIDs(), target),
+		Data:    &domain.ParticipantEvent{MeetingID: m.ID, UserID: target},
+	})
+	return nil
+}
+
+func (s *service) PromoteOrganizer(mid string, target string, uid string) error {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	return s.modifyAndNotify(ctx, mid, func(m *domain.Meeting) error {
+		// Check permissions
+		if !m.IsOwner(uid) {
+			return domain.ErrForbidden
+		}
+		if !m.IsParticipant(target) {
+			return domain.ErrNotFound
+		}
+		if m.IsOrganizer(target) {
+			return errUnchanged
+		}
+
+		// Promote participant
+		m.AddOrganizer(target)
+		return nil
+	})
+}
+
+func (s *service) DemoteOrganizer(mid string, target string, uid string) error {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	return s.modifyAndNotify(ctx, mid, func(m *domain.Meeting) error {
+		// Check permissions
+		if !m.IsOwner(uid) || m.IsOwner(target) {
+			return domain.ErrForbidden
+		}
+		if !m.IsOrganizer(target) {
+			return domain.ErrNotFound
+		}
+
+		// Demote organizer
+		m.RemoveOrganizer(target)
+		return nil
+	})
+}
+
+func (s *service) TransferOwnership(mid string, dto *domain.TransferOwnershipDto, uid string) error {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	return s.modifyAndNotify(ctx, mid, func(m *domain.Meeting) error {
+		// Check permissions
+		if !m.IsOwner(uid) || m.IsOwner(dto.OwnerID) {
+			return domain.ErrForbidden
+		}
+		if !m.IsParticipant(dto.OwnerID) {
+			return domain.ErrNotFound
+		}
+
+		// Transfer ownership
+		m.TransferOwnership(dto.OwnerID)
+		return nil
+	})
+}
+
+// errUnchanged is returned by a modification if the meeting already is in the desired state
+var errUnchanged = errors.New("unchanged")
+
+// modifyMeeting fetches the meeting, applies fn and saves it.
+// If the meeting was changed in the meantime, it gets fetched again and fn is applied again.
+func (s *service) modifyMeeting(ctx context.Context, mid string, fn func(m *domain.Meeting) error) (*domain.Meeting, error) {
+	var m *domain.Meeting
+	err := domain.RetryOnConflict(func() error {
+		var err error
+		m, err = s.meetingRepo.GetMeetingByID(ctx, mid)
+		if err != nil {
+			return err
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+		return s.meetingRepo.SaveMeeting(ctx, m)
+	})
+	return m, err
+}
+
+// modifyAndNotify modifies the meeting and sends the updated meeting to all members
+func (s *service) modifyAndNotify(ctx context.Context, mid string, fn func(m *domain.Meeting) error) error {
+	m, err := s.modifyMeeting(ctx, mid, fn)
+	if err == errUnchanged {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	s.events.Publish(&domain.Event{
+		Type:    domain.EventMeetingUpdate,
+		UserIDs: m.MemberIDs(),
+		Data:    m,
+	})
+	return nil
+}
+
+// failedInvites returns a failed result with the error for every receiver of the meeting
+func failedInvites(dto *domain.CreateMeetingDto, err error) []*domain.InviteResult {
+	rs := make([]*domain.InviteResult, 0, len(dto.Participants)+len(dto.Usernames))
+	for _, id := range dto.Participants {
+		rs = append(rs, &domain.InviteResult{ReceiverID: id, Error: err.Error()})
+	}
+	for _, n := range dto.Usernames {
+		rs = append(rs, &domain.InviteResult{Username: n, Error: err.Error()})
+	}
+	return rs
+}
 
-	// Delete meeting
-	return s.meetingRepo.DeleteMeeting(ctx, mid)
+// validName returns true if the meeting name is not empty and not too long
+func validName(name string) bool {
+	return name != "" && utf8.RuneCountInString(name) <= domain.MaxMeetingNameLength
 }
@@ -0,0 +1,92 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package turn
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"github.com/hearky/server/pkg/domain"
+	"time"
+)
+
+type service struct {
+	meetingRepo domain.MeetingRepository
+	secret      string
+	turnServers []string
+	stunServers []string
+	ttl         time.Duration
+}
+
+// NewService creates a service issuing TURN credentials in the format of the coturn REST API,
+// if no secret is configured only the STUN servers get returned
+func NewService(meetingRepository domain.MeetingRepository, secret string, turnServers []string, stunServers []string, ttl time.Duration) domain.IceService {
+	return &service{
+		meetingRepo: meetingRepository,
+		secret:      secret,
+		turnServers: turnServers,
+		stunServers: stunServers,
+		ttl:         ttl,
+	}
+}
+
+func (s *service) GetIceServers(mid string, uid string) (*domain.IceServers, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Fetch meeting
+	m, err := s.meetingRepo.GetMeetingByID(ctx, mid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check permissions
+	if !m.IsParticipant(uid) {
+		return nil, domain.ErrForbidden
+	}
+
+	is := &domain.IceServers{
+		Servers: make([]*domain.IceServer, 0, 2),
+		TTL:     int64(s.ttl.Seconds()),
+	}
+	if len(s.stunServers) > 0 {
+		is.Servers = append(is.Servers, &domain.IceServer{URLs: s.stunServers})
+	}
+	if s.secret != "" && len(s.turnServers) > 0 {
+		username, credential := s.credentials(uid)
+		is.Servers = append(is.Servers, &domain.IceServer{
+			URLs:       s.turnServers,
+			Username:   username,
+			Credential: credential,
+		})
+	}
+	return is, nil
+}
+
+// credentials creates a time-limited username and password,
+// the username contains the expiry timestamp and the password is its HMAC-SHA1 signed with the shared secret
+func (s *service) credentials(uid string) (string, string) {
+	username := fmt.Sprintf("%d:%s", time.Now().Add(s.ttl).Unix(), uid)
+	mac := hmac.New(sha1.New, []byte(s.secret))
+	mac.Write([]byte(username))
+	return username, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,184 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package user
+
+import (
+	"context"
+	"github.com/hearky/server/pkg/domain"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	// deletionRetryInterval is the interval in which failed deletions are retried, and the initial backoff of a job
+	deletionRetryInterval = time.Minute
+	// deletionMaxBackoff is the maximum time between two attempts of a job
+	deletionMaxBackoff = 6 * time.Hour
+)
+
+// ResumeDeletions continues all unfinished deletions and keeps retrying failed ones with an exponential backoff
+func (s *service) ResumeDeletions() {
+	s.resumeDeletions(true)
+	t := time.NewTicker(deletionRetryInterval)
+	defer t.Stop()
+	for range t.C {
+		s.resumeDeletions(false)
+	}
+}
+
+// resumeDeletions runs the unfinished jobs, unless all is set only the ones whose backoff elapsed
+func (s *service) resumeDeletions(all bool) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Fetch unfinished jobs
+	js, err := s.deletionRepo.GetJobs(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, j := range js {
+		if !all && time.Since(j.UpdatedAt) < deletionBackoff(j.Attempts) {
+			continue
+		}
+		ctx, ccl := context.WithTimeout(context.Background(), 20*time.Second)
+		err := s.runDeletion(ctx, j)
+		ccl()
+		if err != nil {
+			zap.L().Warn("failed to resume deletion of user", zap.String("user", j.UserID), zap.Error(err))
+		}
+	}
+}
+
+// deletionBackoff returns the time to wait after the last update of a job which failed the given number of times
+func deletionBackoff(attempts int) time.Duration {
+	d := deletionRetryInterval
+	for i := 0; i < attempts && d < deletionMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > deletionMaxBackoff {
+		d = deletionMaxBackoff
+	}
+	return d
+}
+
+// runDeletion executes all remaining steps of the job. Every step can be run multiple times,
+// so if one fails, the job can be retried later on.
+func (s *service) runDeletion(ctx context.Context, j *domain.DeletionJob) error {
+	for j.Step < domain.DeletionStepDone {
+		err := s.runDeletionStep(ctx, j.UserID, j.Step)
+		j.UpdatedAt = time.Now()
+		if err != nil {
+			j.Attempts++
+			j.LastError = err.Error()
+			_ = s.deletionRepo.SaveJob(ctx, j)
+			return err
+		}
+		j.Step++
+		err = s.deletionRepo.SaveJob(ctx, j)
+		if err != nil {
+			return err
+		}
+	}
+	return s.deletionRepo.DeleteJob(ctx, j.UserID)
+}
+
+func (s *service) runDeletionStep(ctx context.Context, uid string, step int) error {
+	switch step {
+	case domain.DeletionStepRevokeSentInvites:
+		is, err := s.inviteRepo.GetInvitesBySender(ctx, uid)
+		if err != nil {
+			return err
+		}
+		return s.deleteInvites(ctx, is)
+
+	case domain.DeletionStepDeleteReceivedInvites:
+		is, err := s.inviteRepo.GetInviteHistoryByReceiver(ctx, uid)
+		if err != nil {
+			return err
+		}
+		return s.deleteInvites(ctx, is)
+
+	case domain.DeletionStepLeaveMeetings:
+		ms, err := s.meetingRepo.GetMeetingsByUser(ctx, uid)
+		if err != nil {
+			return err
+		}
+		for _, m := range ms {
+			// The user became owner after the deletion was started, the ownership has to be transferred first
+			if m.IsOwner(uid) {
+				return domain.ErrOwnerOfMeeting
+			}
+			err := s.meetingRepo.RemoveParticipant(ctx, m.ID, uid)
+			if err == domain.ErrNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			s.events.Publish(&domain.Event{
+				Type:    domain.EventMeetingParticipantRemove,
+				UserIDs: m.MemberIDs(),
+				Data:    &domain.ParticipantEvent{MeetingID: m.ID, UserID: uid},
+			})
+		}
+		return nil
+
+	case domain.DeletionStepDeleteUser:
+		return s.userRepo.DeleteUser(ctx, uid)
+
+	case domain.DeletionStepDeleteFriendships:
+		return s.friendRepo.DeleteFriendshipsByUser(ctx, uid)
+
+	case domain.DeletionStepDeleteBlocks:
+		return s.blockRepo.DeleteBlocksByUser(ctx, uid)
+
+	case domain.DeletionStepDeleteAccount:
+		if s.accounts == nil {
+			return nil
+		}
+		return s.accounts.DeleteAccount(ctx, uid)
+	}
+	return nil
+}
+
+// deleteInvites deletes the invites including their history,
+// the receivers and the organizers of the meetings are notified about pending ones
+func (s *service) deleteInvites(ctx context.Context, is []*domain.Invite) error {
+	for _, i := range is {
+		err := s.inviteRepo.DeleteInvite(ctx, i.ID)
+		if err != nil {
+			return err
+		}
+		if !i.IsPending() {
+			continue
+		}
+
+		var organizers []string
+		if m, err := s.meetingRepo.GetMeetingByID(ctx, i.MeetingID); err == nil {
+			organizers = m.OrganizerIDs()
+		}
+		s.events.Publish(&domain.Event{
+			Type:    domain.EventInviteDelete,
+			UserIDs: i.RecipientIDs(organizers),
+			Data:    i,
+		})
+	}
+	return nil
+}
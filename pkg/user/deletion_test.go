@@ -0,0 +1,152 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package user
+
+import (
+	"context"
+	"errors"
+	"github.com/hearky/server/pkg/domain"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// deletionRecorder implements all repositories used by a deletion and records the executed steps
+type deletionRecorder struct {
+	domain.UserRepository
+	domain.MeetingRepository
+	domain.InviteRepository
+	domain.DeletionJobRepository
+	domain.FriendshipRepository
+	domain.BlockRepository
+	calls []string
+	fail  string
+}
+
+func (r *deletionRecorder) call(name string) error {
+	r.calls = append(r.calls, name)
+	if r.fail == name {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+func (r *deletionRecorder) GetInvitesBySender(context.Context, string) ([]*domain.Invite, error) {
+	return nil, r.call("sent invites")
+}
+
+func (r *deletionRecorder) GetInviteHistoryByReceiver(context.Context, string) ([]*domain.Invite, error) {
+	return nil, r.call("received invites")
+}
+
+func (r *deletionRecorder) GetMeetingsByUser(context.Context, string) ([]*domain.Meeting, error) {
+	return nil, r.call("meetings")
+}
+
+func (r *deletionRecorder) DeleteUser(context.Context, string) error {
+	return r.call("user")
+}
+
+func (r *deletionRecorder) DeleteFriendshipsByUser(context.Context, string) error {
+	return r.call("friendships")
+}
+
+func (r *deletionRecorder) DeleteBlocksByUser(context.Context, string) error {
+	return r.call("blocks")
+}
+
+func (r *deletionRecorder) DeleteAccount(context.Context, string) error {
+	return r.call("account")
+}
+
+func (r *deletionRecorder) SaveJob(context.Context, *domain.DeletionJob) error {
+	return nil
+}
+
+func (r *deletionRecorder) DeleteJob(context.Context, string) error {
+	return r.call("job")
+}
+
+func newDeletionService(r *deletionRecorder) *service {
+	return &service{
+		userRepo:     r,
+		meetingRepo:  r,
+		inviteRepo:   r,
+		deletionRepo: r,
+		friendRepo:   r,
+		blockRepo:    r,
+		accounts:     r,
+	}
+}
+
+func TestRunDeletion(t *testing.T) {
+	tests := []struct {
+		name  string
+		step  int
+		fail  string
+		calls []string
+	}{
+		{
+			name:  "all steps",
+			step:  domain.DeletionStepRevokeSentInvites,
+			calls: []string{"sent invites", "received invites", "meetings", "user", "friendships", "blocks", "account", "job"},
+		},
+		{
+			name:  "account is not deleted if a step fails",
+			step:  domain.DeletionStepRevokeSentInvites,
+			fail:  "friendships",
+			calls: []string{"sent invites", "received invites", "meetings", "user", "friendships"},
+		},
+		{
+			name:  "job stored at the former account step",
+			step:  domain.DeletionStepLeaveMeetings + 1,
+			calls: []string{"user", "friendships", "blocks", "account", "job"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &deletionRecorder{fail: tt.fail}
+			j := &domain.DeletionJob{UserID: "user", Step: tt.step}
+			err := newDeletionService(r).runDeletion(context.Background(), j)
+			if (err != nil) != (tt.fail != "") {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(r.calls, tt.calls) {
+				t.Fatalf("expected steps %v, got %v", tt.calls, r.calls)
+			}
+		})
+	}
+}
+
+func TestDeletionBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		backoff  time.Duration
+	}{
+		{0, time.Minute},
+		{1, 2 * time.Minute},
+		{3, 8 * time.Minute},
+		{20, deletionMaxBackoff},
+	}
+	for _, tt := range tests {
+		if b := deletionBackoff(tt.attempts); b != tt.backoff {
+			t.Errorf("expected backoff %v after %d attempts, got %v", tt.backoff, tt.attempts, b)
+		}
+	}
+}
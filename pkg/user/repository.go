@@ -76,17 +76,24 @@ func (r *repository) GetUserByID(ctx context.Context, uid string) (*domain.User,
 }
 
 func (r *repository) SaveUser(ctx context.Context, u *domain.User) error {
-	_, err := r.col.UpdateByID(ctx, u.ID, bson.D{{
-		"$set", bson.D{
-			{"username", u.Username},
-			{"upgrade", u.Upgrade},
+	res, err := r.col.UpdateOne(ctx, versionFilter(u.ID, u.Version), bson.M{
+		"$set": bson.M{
+			"username": u.Username,
+			"flags":    u.Flags,
+			"settings": u.Settings,
+			"upgrade":  u.Upgrade,
 		},
-	}})
+		"$inc": bson.M{"version": 1},
+	})
 	if err != nil {
 		sentry.CaptureException(err)
 		zap.L().Error("failed to update user", zap.Any("user", u), zap.Error(err))
 		return domain.ErrInternal
 	}
+	if res.MatchedCount == 0 {
+		return domain.ErrConflict
+	}
+	u.Version++
 	return nil
 }
 
@@ -99,3 +106,12 @@ func (r *repository) DeleteUser(ctx context.Context, uid string) error {
 	}
 	return nil
 }
+
+// versionFilter matches the user only if it still has the passed version,
+// users created before versioning have no version field which equals version 0
+func versionFilter(id string, version int64) bson.M {
+	if version == 0 {
+		return bson.M{"_id": id, "version": bson.M{"$in": bson.A{0, nil}}}
+	}
+	return bson.M{"_id": id, "version": version}
+}
@@ -25,16 +25,30 @@ import (
 )
 
 type service struct {
-	userRepo    domain.UserRepository
-	meetingRepo domain.MeetingRepository
-	inviteRepo  domain.InviteRepository
+	userRepo     domain.UserRepository
+	meetingRepo  domain.MeetingRepository
+	inviteRepo   domain.InviteRepository
+	deletionRepo domain.DeletionJobRepository
+	friendRepo   domain.FriendshipRepository
+	blockRepo    domain.BlockRepository
+	accounts     domain.AccountDeleter
+	audit        domain.AuditService
+	events       domain.EventBus
 }
 
-func NewService(userRepository domain.UserRepository, meetingRepository domain.MeetingRepository, inviteRepository domain.InviteRepository) domain.UserService {
+// NewService creates a new user service, if accountDeleter is nil,
+// deleting a user does not delete their account at the authentication provider
+func NewService(userRepository domain.UserRepository, meetingRepository domain.MeetingRepository, inviteRepository domain.InviteRepository, deletionJobRepository domain.DeletionJobRepository, friendshipRepository domain.FriendshipRepository, blockRepository domain.BlockRepository, accountDeleter domain.AccountDeleter, auditService domain.AuditService, eventBus domain.EventBus) domain.UserService {
 	return &service{
-		userRepo:    userRepository,
-		meetingRepo: meetingRepository,
-		inviteRepo:  inviteRepository,
+		userRepo:     userRepository,
+		meetingRepo:  meetingRepository,
+		inviteRepo:   inviteRepository,
+		deletionRepo: deletionJobRepository,
+		friendRepo:   friendshipRepository,
+		blockRepo:    blockRepository,
+		accounts:     accountDeleter,
+		audit:        auditService,
+		events:       eventBus,
 	}
 }
 
@@ -81,13 +95,94 @@ func (s *service) GetUser(id string, uid string) (*domain.User, error) {
 		return nil, err
 	}
 
-	//TODO: Implement User Flag Check -> Moderator, Admin etc...
+	// Check permissions, moderators and admins can read every user
 	if u.ID != uid {
-		return nil, domain.ErrForbidden
+		e, err := s.audit.Override(ctx, uid, domain.PermissionReadUsers, domain.AuditActionReadUser, u.ID)
+		if err != nil {
+			return nil, err
+		}
+		s.audit.Complete(e, nil)
 	}
 	return u, nil
 }
 
+func (s *service) UpdateSettings(dto *domain.UpdateUserSettingsDto, uid string) (*domain.User, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	var u *domain.User
+	err := domain.RetryOnConflict(func() error {
+		// Fetch account
+		var err error
+		u, err = s.userRepo.GetUserByID(ctx, uid)
+		if err != nil {
+			return err
+		}
+
+		// Apply changes
+		if dto.FriendsOnlyInvites != nil {
+			u.Settings.FriendsOnlyInvites = *dto.FriendsOnlyInvites
+		}
+		return s.userRepo.SaveUser(ctx, u)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (s *service) ExportUser(uid string) (*domain.UserExport, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 20*time.Second)
+	defer ccl()
+
+	// Fetch account
+	u, err := s.userRepo.GetUserByID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch meetings and invites
+	ms, err := s.meetingRepo.GetMeetingsByUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	sent, err := s.inviteRepo.GetInvitesBySender(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	history, err := s.inviteRepo.GetInviteHistoryByReceiver(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	// Suppressed invites are left out, the user must not learn about them
+	received := make([]*domain.Invite, 0, len(history))
+	for _, i := range history {
+		if !i.Suppressed {
+			received = append(received, i)
+		}
+	}
+	fs, err := s.friendRepo.GetFriendshipsByUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := s.blockRepo.GetBlocksByUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.UserExport{
+		ExportedAt:      time.Now(),
+		User:            u,
+		Meetings:        ms,
+		InvitesSent:     sent,
+		InvitesReceived: received,
+		Friendships:     fs,
+		Blocks:          bs,
+	}, nil
+}
+
 func (s *service) DeleteUser(id string, uid string) error {
 	// Define timeout
 	ctx, ccl := context.WithTimeout(context.Background(), 20*time.Second)
@@ -99,11 +194,22 @@ func (s *service) DeleteUser(id string, uid string) error {
 		return err
 	}
 
-	//TODO: Implement User Flag Check -> Moderator, Admin etc...
+	// Check permissions, admins can delete every user
+	var e *domain.AuditEntry
 	if u.ID != uid {
-		return domain.ErrForbidden
+		e, err = s.audit.Override(ctx, uid, domain.PermissionDeleteUsers, domain.AuditActionDeleteUser, u.ID)
+		if err != nil {
+			return err
+		}
 	}
 
+	err = s.deleteUser(ctx, id)
+	s.audit.Complete(e, err)
+	return err
+}
+
+// deleteUser starts or resumes the deletion of the user, it fails if the user still owns meetings
+func (s *service) deleteUser(ctx context.Context, id string) error {
 	// Fetch meetings
 	ms, err := s.meetingRepo.GetMeetingsByUser(ctx, id)
 	if err != nil {
@@ -117,14 +223,19 @@ func (s *service) DeleteUser(id string, uid string) error {
 		}
 	}
 
-	// Fetch invites and delete them
-	is, err := s.inviteRepo.GetInvitesByReceiver(ctx, id)
+	// Start the deletion, or resume it if it already was started before
+	j := &domain.DeletionJob{
+		UserID:    id,
+		Step:      domain.DeletionStepRevokeSentInvites,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	err = s.deletionRepo.CreateJob(ctx, j)
+	if err == domain.ErrConflict {
+		j, err = s.deletionRepo.GetJobByUser(ctx, id)
+	}
 	if err != nil {
 		return err
 	}
-	for _, i := range is {
-		_ = s.inviteRepo.DeleteInvite(ctx, i.ID)
-	}
-
-	return nil
+	return s.runDeletion(ctx, j)
 }
@@ -0,0 +1,588 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package voice
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/getsentry/sentry-go"
+	"github.com/google/uuid"
+	"github.com/hearky/server/pkg/domain"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// channel is the broker channel the voice states are synchronized on
+const channel = "hearky:voice"
+
+const (
+	messageUpdate    = "update"
+	messageRemove    = "remove"
+	messageSync      = "sync"
+	messageHeartbeat = "heartbeat"
+	messageMute      = "mute"
+)
+
+var (
+	// instanceHeartbeat is the interval in which every instance announces that it is still running
+	instanceHeartbeat = 10 * time.Second
+	// instanceTimeout is the time after which the voice states of a silent instance get dropped
+	instanceTimeout = 3 * instanceHeartbeat
+)
+
+// message is exchanged between the server instances to keep their voice states in sync
+type message struct {
+	Type     string             `json:"type"`
+	Origin   string             `json:"origin"`
+	Instance string             `json:"instance,omitempty"`
+	State    *domain.VoiceState `json:"state,omitempty"`
+}
+
+// entry is a voice state together with the instance managing its session
+type entry struct {
+	state    domain.VoiceState
+	instance string
+}
+
+type service struct {
+	instance    string
+	meetingRepo domain.MeetingRepository
+	blockRepo   domain.BlockRepository
+	events      domain.EventBus
+	broker      domain.Broker
+
+	mu        sync.RWMutex
+	rooms     map[string]map[string]*entry
+	users     map[string]string
+	instances map[string]time.Time
+	// serverMuted contains the users muted by an organizer per meeting, it outlives their voice states
+	serverMuted map[string]map[string]struct{}
+}
+
+func NewService(meetingRepository domain.MeetingRepository, blockRepository domain.BlockRepository, eventBus domain.EventBus, broker domain.Broker) (domain.VoiceService, error) {
+	s := &service{
+		instance:    uuid.New().String(),
+		meetingRepo: meetingRepository,
+		blockRepo:   blockRepository,
+		events:      eventBus,
+		broker:      broker,
+		rooms:       make(map[string]map[string]*entry),
+		users:       make(map[string]string),
+		instances:   make(map[string]time.Time),
+		serverMuted: make(map[string]map[string]struct{}),
+	}
+	err := broker.Subscribe(channel, s.receive)
+	if err != nil {
+		return nil, err
+	}
+	eventBus.Subscribe(s.handleEvent)
+
+	// Request the voice states managed by the other instances
+	s.publish(&message{Type: messageSync})
+	go s.heartbeat()
+	return s, nil
+}
+
+func (s *service) JoinVoice(mid string, uid string, sessionID string, dto *domain.JoinVoiceDto) (*domain.VoiceState, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Fetch meeting
+	m, err := s.meetingRepo.GetMeetingByID(ctx, mid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check permissions, users blocked by the owner can not join the voice room
+	if !m.IsParticipant(uid) {
+		return nil, domain.ErrForbidden
+	}
+	blocked, err := s.blockRepo.IsBlocked(ctx, m.OwnerID, uid)
+	if err != nil {
+		return nil, err
+	} else if blocked {
+		return nil, domain.ErrForbidden
+	}
+
+	// A user can only be connected to one voice room at a time
+	if prev, ok := s.roomOf(uid); ok && prev != mid {
+		if e, ok := s.lookup(prev, uid); ok {
+			s.leave(ctx, &e.state)
+		}
+	}
+
+	// A server mute stays in place when the user joins again
+	st := &domain.VoiceState{
+		MeetingID:   mid,
+		UserID:      uid,
+		SessionID:   sessionID,
+		Connected:   true,
+		Muted:       dto.Muted || dto.Deafened || m.Settings.MuteOnJoin,
+		Deafened:    dto.Deafened,
+		ServerMuted: s.isServerMuted(mid, uid),
+	}
+	s.update(st, s.instance)
+	s.notify(m.MemberIDs(), st)
+	return st, nil
+}
+
+func (s *service) LeaveVoice(mid string, uid string) error {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	e, ok := s.lookup(mid, uid)
+	if !ok {
+		return domain.ErrNotFound
+	}
+	s.leave(ctx, &e.state)
+	return nil
+}
+
+func (s *service) UpdateVoiceState(mid string, uid string, dto *domain.UpdateVoiceStateDto) (*domain.VoiceState, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	e, ok := s.lookup(mid, uid)
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	st := &e.state
+
+	// Fetch meeting
+	m, err := s.meetingRepo.GetMeetingByID(ctx, mid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply changes, a deafened user is always muted
+	if dto.Muted != nil {
+		st.Muted = *dto.Muted
+	}
+	if dto.Deafened != nil {
+		st.Deafened = *dto.Deafened
+	}
+	if dto.Speaking != nil {
+		st.Speaking = *dto.Speaking
+	}
+	if st.Deafened {
+		st.Muted = true
+	}
+	if st.Muted || st.ServerMuted {
+		st.Speaking = false
+	}
+
+	s.update(st, e.instance)
+	s.notify(m.MemberIDs(), st)
+	return st, nil
+}
+
+func (s *service) ModerateVoiceState(mid string, target string, uid string, dto *domain.ModerateVoiceStateDto) (*domain.VoiceState, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	e, ok := s.lookup(mid, target)
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	st := &e.state
+
+	// Fetch meeting
+	m, err := s.meetingRepo.GetMeetingByID(ctx, mid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check permissions
+	if !m.CanModerate(uid, target) {
+		return nil, domain.ErrForbidden
+	}
+
+	// Apply changes
+	if dto.ServerMuted != nil {
+		st.ServerMuted = *dto.ServerMuted
+	}
+	if st.ServerMuted {
+		st.Speaking = false
+	}
+
+	s.update(st, e.instance)
+	s.notify(m.MemberIDs(), st)
+	return st, nil
+}
+
+func (s *service) GetVoiceStates(mid string, uid string) ([]*domain.VoiceState, error) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	// Fetch meeting
+	m, err := s.meetingRepo.GetMeetingByID(ctx, mid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check permissions
+	if !m.IsParticipant(uid) {
+		return nil, domain.ErrForbidden
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sts := make([]*domain.VoiceState, 0, len(s.rooms[mid]))
+	for _, e := range s.rooms[mid] {
+		st := e.state
+		sts = append(sts, &st)
+	}
+	return sts, nil
+}
+
+func (s *service) Disconnect(sessionID string) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	var sts []*domain.VoiceState
+	s.mu.RLock()
+	for _, r := range s.rooms {
+		for _, e := range r {
+			if e.state.SessionID == sessionID {
+				st := e.state
+				sts = append(sts, &st)
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, st := range sts {
+		s.leave(ctx, st)
+	}
+}
+
+func (s *service) KickBlocked(target string, uid string) {
+	// Define timeout
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+
+	mid, ok := s.roomOf(target)
+	if !ok {
+		return
+	}
+
+	// Fetch meeting, users blocked by the owner can not be connected to its voice room
+	m, err := s.meetingRepo.GetMeetingByID(ctx, mid)
+	if err != nil || !m.IsOwner(uid) {
+		return
+	}
+	if e, ok := s.lookup(mid, target); ok {
+		s.leave(ctx, &e.state)
+	}
+}
+
+// leave removes the voice state and notifies the members of the meeting
+func (s *service) leave(ctx context.Context, st *domain.VoiceState) {
+	s.remove(st.MeetingID, st.UserID)
+	s.publish(&message{Type: messageRemove, State: st})
+
+	// If the meeting does not exist anymore, there is nobody to notify
+	m, err := s.meetingRepo.GetMeetingByID(ctx, st.MeetingID)
+	if err != nil {
+		return
+	}
+	st.Connected = false
+	st.Speaking = false
+	s.notify(m.MemberIDs(), st)
+}
+
+// notify dispatches the voice state to the passed users
+func (s *service) notify(uids []string, st *domain.VoiceState) {
+	s.events.Publish(&domain.Event{
+		Type:    domain.EventVoiceStateUpdate,
+		UserIDs: uids,
+		Data:    st,
+	})
+}
+
+// update stores the voice state and synchronizes it with the other instances
+func (s *service) update(st *domain.VoiceState, instance string) {
+	s.set(st, instance)
+	s.publish(&message{Type: messageUpdate, Instance: instance, State: st})
+}
+
+// lookup returns a copy of the voice state of a user in a meeting
+func (s *service) lookup(mid string, uid string) (entry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.rooms[mid][uid]
+	if !ok {
+		return entry{}, false
+	}
+	return *e, true
+}
+
+// roomOf returns the id of the meeting the user is connected to
+func (s *service) roomOf(uid string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	mid, ok := s.users[uid]
+	return mid, ok
+}
+
+// isServerMuted returns true if an organizer muted the user in the meeting
+func (s *service) isServerMuted(mid string, uid string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.serverMuted[mid][uid]
+	return ok
+}
+
+func (s *service) setServerMutedLocked(mid string, uid string, muted bool) {
+	us, ok := s.serverMuted[mid]
+	if !muted {
+		delete(us, uid)
+		if ok && len(us) == 0 {
+			delete(s.serverMuted, mid)
+		}
+		return
+	}
+	if !ok {
+		us = make(map[string]struct{})
+		s.serverMuted[mid] = us
+	}
+	us[uid] = struct{}{}
+}
+
+// set stores the voice state and removes the user from any other voice room
+func (s *service) set(st *domain.VoiceState, instance string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setServerMutedLocked(st.MeetingID, st.UserID, st.ServerMuted)
+	if prev, ok := s.users[st.UserID]; ok && prev != st.MeetingID {
+		s.removeLocked(prev, st.UserID)
+	}
+	r, ok := s.rooms[st.MeetingID]
+	if !ok {
+		r = make(map[string]*entry)
+		s.rooms[st.MeetingID] = r
+	}
+	r[st.UserID] = &entry{state: *st, instance: instance}
+	s.users[st.UserID] = st.MeetingID
+
+	// States of an instance count as its heartbeat until it sends its own
+	if _, ok := s.instances[instance]; !ok && instance != s.instance {
+		s.instances[instance] = time.Now()
+	}
+}
+
+// remove deletes the voice state of a user in a meeting
+func (s *service) remove(mid string, uid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeLocked(mid, uid)
+}
+
+func (s *service) removeLocked(mid string, uid string) {
+	r, ok := s.rooms[mid]
+	if !ok {
+		return
+	}
+	delete(r, uid)
+	if len(r) == 0 {
+		delete(s.rooms, mid)
+	}
+	if s.users[uid] == mid {
+		delete(s.users, uid)
+	}
+}
+
+// removeRoom deletes all voice states and server mutes of a meeting
+func (s *service) removeRoom(mid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.serverMuted, mid)
+	for uid := range s.rooms[mid] {
+		if s.users[uid] == mid {
+			delete(s.users, uid)
+		}
+	}
+	delete(s.rooms, mid)
+}
+
+// publish sends a message to all other server instances
+func (s *service) publish(m *message) {
+	m.Origin = s.instance
+	payload, err := json.Marshal(m)
+	if err != nil {
+		sentry.CaptureException(err)
+		zap.L().Error("failed to encode voice message", zap.Error(err))
+		return
+	}
+
+	ctx, ccl := context.WithTimeout(context.Background(), 5*time.Second)
+	defer ccl()
+	_ = s.broker.Publish(ctx, channel, payload)
+}
+
+// receive applies the changes made by other server instances
+func (s *service) receive(payload []byte) {
+	var m message
+	if err := json.Unmarshal(payload, &m); err != nil {
+		zap.L().Error("failed to decode voice message", zap.Error(err))
+		return
+	}
+	if m.Origin == s.instance {
+		return
+	}
+
+	// Every message shows that its instance is still running
+	s.mu.Lock()
+	s.instances[m.Origin] = time.Now()
+	s.mu.Unlock()
+
+	switch m.Type {
+	case messageUpdate:
+		if m.State != nil {
+			s.set(m.State, m.Instance)
+		}
+	case messageRemove:
+		if m.State != nil {
+			s.remove(m.State.MeetingID, m.State.UserID)
+		}
+	case messageMute:
+		if m.State != nil {
+			s.mu.Lock()
+			s.setServerMutedLocked(m.State.MeetingID, m.State.UserID, m.State.ServerMuted)
+			s.mu.Unlock()
+		}
+	case messageSync:
+		// Send all voice states managed by this instance and all server mutes to the new one
+		var sts []*domain.VoiceState
+		var mutes []*domain.VoiceState
+		s.mu.RLock()
+		for _, r := range s.rooms {
+			for _, e := range r {
+				if e.instance == s.instance {
+					st := e.state
+					sts = append(sts, &st)
+				}
+			}
+		}
+		for mid, us := range s.serverMuted {
+			for uid := range us {
+				mutes = append(mutes, &domain.VoiceState{MeetingID: mid, UserID: uid, ServerMuted: true})
+			}
+		}
+		s.mu.RUnlock()
+		for _, st := range sts {
+			s.publish(&message{Type: messageUpdate, Instance: s.instance, State: st})
+		}
+		for _, st := range mutes {
+			s.publish(&message{Type: messageMute, State: st})
+		}
+	}
+}
+
+// heartbeat periodically announces this instance and drops the voice states of instances which stopped
+func (s *service) heartbeat() {
+	t := time.NewTicker(instanceHeartbeat)
+	defer t.Stop()
+	for range t.C {
+		s.publish(&message{Type: messageHeartbeat})
+		s.dropStopped()
+	}
+}
+
+// dropStopped removes the voice states of all instances which did not send a heartbeat within the instanceTimeout.
+// Every instance removes them, but only the one with the lowest id notifies the members.
+func (s *service) dropStopped() {
+	var sts []*domain.VoiceState
+	notify := true
+	s.mu.Lock()
+	for i, seen := range s.instances {
+		if time.Since(seen) > instanceTimeout {
+			delete(s.instances, i)
+		} else if i < s.instance {
+			notify = false
+		}
+	}
+	for _, r := range s.rooms {
+		for _, e := range r {
+			if _, ok := s.instances[e.instance]; !ok && e.instance != s.instance {
+				st := e.state
+				sts = append(sts, &st)
+			}
+		}
+	}
+	for _, st := range sts {
+		s.removeLocked(st.MeetingID, st.UserID)
+	}
+	s.mu.Unlock()
+
+	if !notify {
+		return
+	}
+	ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ccl()
+	for _, st := range sts {
+		zap.L().Info("dropping voice state of stopped instance", zap.String("meeting", st.MeetingID), zap.String("user", st.UserID))
+		s.leave(ctx, st)
+	}
+}
+
+// handleEvent removes users from the voice room once they are not part of the meeting anymore
+func (s *service) handleEvent(e *domain.Event) {
+	raw, ok := e.Data.(json.RawMessage)
+	if !ok {
+		return
+	}
+
+	switch e.Type {
+	case domain.EventMeetingDelete:
+		var msg domain.IDMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return
+		}
+		s.removeRoom(msg.ID)
+	case domain.EventMeetingParticipantRemove:
+		var pe domain.ParticipantEvent
+		if err := json.Unmarshal(raw, &pe); err != nil {
+			return
+		}
+
+		// A server mute ends once the user is not part of the meeting anymore
+		s.mu.Lock()
+		s.setServerMutedLocked(pe.MeetingID, pe.UserID, false)
+		s.mu.Unlock()
+
+		// Only the instance managing the session notifies the members, the others follow its message
+		en, ok := s.lookup(pe.MeetingID, pe.UserID)
+		if !ok || en.instance != s.instance {
+			return
+		}
+		go func() {
+			ctx, ccl := context.WithTimeout(context.Background(), 10*time.Second)
+			defer ccl()
+			s.leave(ctx, &en.state)
+		}()
+	}
+}
@@ -0,0 +1,160 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package voice
+
+import (
+	"context"
+	"github.com/hearky/server/pkg/broker"
+	"github.com/hearky/server/pkg/domain"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeMeetingRepository struct {
+	domain.MeetingRepository
+	meeting *domain.Meeting
+}
+
+func (r *fakeMeetingRepository) GetMeetingByID(_ context.Context, id string) (*domain.Meeting, error) {
+	if r.meeting.ID != id {
+		return nil, domain.ErrNotFound
+	}
+	m := *r.meeting
+	return &m, nil
+}
+
+type fakeBlockRepository struct {
+	domain.BlockRepository
+}
+
+func (r *fakeBlockRepository) IsBlocked(context.Context, string, string) (bool, error) {
+	return false, nil
+}
+
+// fakeEventBus records all published events
+type fakeEventBus struct {
+	mu     sync.Mutex
+	events []*domain.Event
+}
+
+func (b *fakeEventBus) Publish(e *domain.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = append(b.events, e)
+}
+
+func (b *fakeEventBus) Subscribe(func(e *domain.Event)) {}
+
+func newTestService(t *testing.T) (*service, *fakeEventBus) {
+	b := broker.NewMemory()
+	t.Cleanup(func() { _ = b.Close() })
+	events := &fakeEventBus{}
+	meetings := &fakeMeetingRepository{meeting: &domain.Meeting{
+		ID:           "meeting",
+		OwnerID:      "owner",
+		Participants: []string{"user"},
+	}}
+	s, err := NewService(meetings, &fakeBlockRepository{}, events, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.(*service), events
+}
+
+func TestDropStoppedInstance(t *testing.T) {
+	s, events := newTestService(t)
+
+	// The owner is connected to a running instance, the user to one which stopped
+	s.set(&domain.VoiceState{MeetingID: "meeting", UserID: "owner", Connected: true}, "running")
+	s.set(&domain.VoiceState{MeetingID: "meeting", UserID: "user", Connected: true}, "stopped")
+	s.mu.Lock()
+	s.instances["stopped"] = time.Now().Add(-2 * instanceTimeout)
+	s.mu.Unlock()
+
+	s.dropStopped()
+	if _, ok := s.lookup("meeting", "user"); ok {
+		t.Error("voice state of the stopped instance was not dropped")
+	}
+	if _, ok := s.lookup("meeting", "owner"); !ok {
+		t.Error("voice state of the running instance was dropped")
+	}
+
+	// Instance ids are uuids, which are lower than "running", so this instance notifies the members
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	if len(events.events) != 1 || events.events[0].Data.(*domain.VoiceState).Connected {
+		t.Errorf("published %v, want a single disconnected voice state", events.events)
+	}
+}
+
+func TestServerMuteSurvivesRejoin(t *testing.T) {
+	s, _ := newTestService(t)
+	muted := true
+
+	_, err := s.JoinVoice("meeting", "user", "session", &domain.JoinVoiceDto{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.ModerateVoiceState("meeting", "user", "owner", &domain.ModerateVoiceStateDto{ServerMuted: &muted})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Joining again while connected
+	st, err := s.JoinVoice("meeting", "user", "session", &domain.JoinVoiceDto{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.ServerMuted {
+		t.Error("joining again removed the server mute")
+	}
+
+	// Joining again after leaving
+	err = s.LeaveVoice("meeting", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err = s.JoinVoice("meeting", "user", "other-session", &domain.JoinVoiceDto{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.ServerMuted {
+		t.Error("leaving and joining again removed the server mute")
+	}
+}
+
+func TestKickBlocked(t *testing.T) {
+	s, _ := newTestService(t)
+
+	_, err := s.JoinVoice("meeting", "user", "session", &domain.JoinVoiceDto{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only a block by the owner of the meeting removes the user
+	s.KickBlocked("user", "other")
+	if _, ok := s.lookup("meeting", "user"); !ok {
+		t.Fatal("user was removed after being blocked by someone else")
+	}
+	s.KickBlocked("user", "owner")
+	if _, ok := s.lookup("meeting", "user"); ok {
+		t.Error("user is still connected after being blocked by the owner")
+	}
+}
@@ -0,0 +1,177 @@
+/*
+ * Hearky Server
+ * Copyright (C) 2021 Hearky
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/hearky/server/pkg/domain"
+	"strconv"
+)
+
+func (s *Server) HandleAdminGetUsers(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	username := c.Query("username")
+	if username == "" {
+		return s.BadRequest(c)
+	}
+
+	u, err := s.adminService.GetUserByUsername(username, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.JSON(u)
+}
+
+func (s *Server) HandleAdminGetUser(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	id := c.Params("id")
+
+	u, err := s.adminService.GetUser(id, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.JSON(u)
+}
+
+func (s *Server) HandleAdminGetUserMeetings(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	id := c.Params("id")
+
+	m, err := s.adminService.GetUserMeetings(id, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.JSON(m)
+}
+
+func (s *Server) HandleAdminGetUserInvites(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	id := c.Params("id")
+
+	i, err := s.adminService.GetUserInvites(id, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.JSON(i)
+}
+
+func (s *Server) HandleAdminResetUsername(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	id := c.Params("id")
+
+	var dto domain.ResetUsernameDto
+	if len(c.Body()) > 0 {
+		err = c.BodyParser(&dto)
+		if err != nil {
+			return s.BadRequest(c)
+		}
+	}
+
+	u, err := s.adminService.ResetUsername(id, &dto, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.JSON(u)
+}
+
+func (s *Server) HandleAdminUpdateUserUpgrade(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	id := c.Params("id")
+
+	var dto domain.UpdateUserUpgradeDto
+	err = c.BodyParser(&dto)
+	if err != nil {
+		return s.BadRequest(c)
+	}
+
+	u, err := s.adminService.UpdateUserUpgrade(id, &dto, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.JSON(u)
+}
+
+func (s *Server) HandleAdminDeleteMeeting(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	mId := c.Params("id")
+
+	err = s.adminService.DeleteMeeting(mId, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (s *Server) HandleAdminUpdateMeetingUpgrade(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	mId := c.Params("id")
+
+	var dto domain.UpdateMeetingUpgradeDto
+	err = c.BodyParser(&dto)
+	if err != nil {
+		return s.BadRequest(c)
+	}
+
+	m, err := s.adminService.UpdateMeetingUpgrade(mId, &dto, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.JSON(m)
+}
+
+func (s *Server) HandleAdminGetAuditLog(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	limit, err := strconv.ParseInt(c.Query("limit", "100"), 10, 64)
+	if err != nil {
+		return s.BadRequest(c)
+	}
+
+	e, err := s.adminService.GetAuditLog(limit, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.JSON(e)
+}
@@ -57,13 +57,13 @@ func (s *Server) TokenAuth(c *fiber.Ctx) (string, error) {
 		return "", s.Unauthorized(c, "invalid-header")
 	}
 
-	// Check with firebase
+	// Check with the authentication provider
 	ctx, ccl := context.WithTimeout(context.Background(), 5*time.Second)
 	defer ccl()
-	t, err := s.fbAuth.VerifyIDTokenAndCheckRevoked(ctx, tokenParts[1])
+	uid, err := s.auth.Authenticate(ctx, tokenParts[1])
 	if err != nil {
 		return "", s.Unauthorized(c, "invalid-token")
 	}
 
-	return t.UID, nil
+	return uid, nil
 }
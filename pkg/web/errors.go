@@ -19,6 +19,7 @@
 package web
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/hearky/server/pkg/domain"
 	"go.uber.org/zap"
@@ -29,11 +30,26 @@ type errorMsg struct {
 	Message string `json:"message"`
 }
 
+type limitErrorMsg struct {
+	errorMsg
+	Limit     int `json:"limit"`
+	Remaining int `json:"remaining"`
+}
+
 func (s *Server) Error(c *fiber.Ctx, code int, m string) error {
 	return c.Status(code).JSON(&errorMsg{Code: code, Message: m})
 }
 
 func (s *Server) DomainError(c *fiber.Ctx, err error) error {
+	var le *domain.LimitError
+	if errors.As(err, &le) {
+		return c.Status(fiber.StatusBadRequest).JSON(&limitErrorMsg{
+			errorMsg:  errorMsg{Code: fiber.StatusBadRequest, Message: le.Error()},
+			Limit:     le.Limit,
+			Remaining: le.Remaining,
+		})
+	}
+
 	switch err {
 	case domain.ErrTooManyMeetings:
 		return s.Error(c, fiber.StatusBadRequest, err.Error())
@@ -45,6 +61,20 @@ func (s *Server) DomainError(c *fiber.Ctx, err error) error {
 		return s.Error(c, fiber.StatusBadRequest, err.Error())
 	case domain.ErrInviteExists:
 		return s.Error(c, fiber.StatusBadRequest, err.Error())
+	case domain.ErrUserBanned:
+		return s.Error(c, fiber.StatusBadRequest, err.Error())
+	case domain.ErrInvalidInput:
+		return s.Error(c, fiber.StatusBadRequest, err.Error())
+	case domain.ErrFriendshipExists:
+		return s.Error(c, fiber.StatusBadRequest, err.Error())
+	case domain.ErrNotFriends:
+		return s.Error(c, fiber.StatusForbidden, err.Error())
+	case domain.ErrAlreadyMember:
+		return s.Error(c, fiber.StatusBadRequest, err.Error())
+	case domain.ErrMeetingFull:
+		return s.Error(c, fiber.StatusBadRequest, err.Error())
+	case domain.ErrConflict:
+		return s.Error(c, fiber.StatusConflict, err.Error())
 	case domain.ErrInternal:
 		return s.InternalError(c)
 	case domain.ErrNotFound:
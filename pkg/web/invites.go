@@ -43,6 +43,26 @@ func (s *Server) HandleSendInvite(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusOK)
 }
 
+func (s *Server) HandleSendInvites(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+
+	var dto domain.CreateInvitesDto
+	err = c.BodyParser(&dto)
+	if err != nil {
+		return s.BadRequest(c)
+	}
+
+	res, err := s.inviteService.SendInvites(&dto, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+
+	return c.JSON(res)
+}
+
 func (s *Server) HandleAcceptInvite(c *fiber.Ctx) error {
 	uid, err := s.Authorize(c)
 	if err != nil || uid == "" {
@@ -58,14 +78,29 @@ func (s *Server) HandleAcceptInvite(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusOK)
 }
 
-func (s *Server) HandleDeleteInvite(c *fiber.Ctx) error {
+func (s *Server) HandleDeclineInvite(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	id := c.Params("id")
+
+	err = s.inviteService.DeclineInvite(id, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (s *Server) HandleRevokeInvite(c *fiber.Ctx) error {
 	uid, err := s.Authorize(c)
 	if err != nil || uid == "" {
 		return nil
 	}
 	id := c.Params("id")
 
-	err = s.inviteService.DeleteInvite(id, uid)
+	err = s.inviteService.RevokeInvite(id, uid)
 	if err != nil {
 		return s.DomainError(c, err)
 	}
@@ -34,11 +34,11 @@ func (s *Server) HandleCreateMeeting(c *fiber.Ctx) error {
 		return s.BadRequest(c)
 	}
 
-	mId, err := s.meetingService.CreateMeeting(&dto, uid)
+	res, err := s.meetingService.CreateMeeting(&dto, uid)
 	if err != nil {
 		return s.DomainError(c, err)
 	}
-	return c.JSON(&domain.IDMessage{ID: mId})
+	return c.JSON(res)
 }
 
 func (s *Server) HandleGetMeetingByID(c *fiber.Ctx) error {
@@ -55,6 +55,25 @@ func (s *Server) HandleGetMeetingByID(c *fiber.Ctx) error {
 	return c.JSON(m)
 }
 
+func (s *Server) HandleUpdateMeeting(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	mId := c.Params("id")
+	var dto domain.UpdateMeetingDto
+	err = c.BodyParser(&dto)
+	if err != nil {
+		return s.BadRequest(c)
+	}
+
+	m, err := s.meetingService.UpdateMeeting(mId, &dto, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.JSON(m)
+}
+
 func (s *Server) HandleDeleteMeeting(c *fiber.Ctx) error {
 	uid, err := s.Authorize(c)
 	if err != nil || uid == "" {
@@ -69,6 +88,20 @@ func (s *Server) HandleDeleteMeeting(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusOK)
 }
 
+func (s *Server) HandleLeaveMeeting(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	mId := c.Params("id")
+
+	err = s.meetingService.LeaveMeeting(mId, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
 func (s *Server) HandleGetMeetingInvites(c *fiber.Ctx) error {
 	uid, err := s.Authorize(c)
 	if err != nil || uid == "" {
@@ -96,3 +129,159 @@ func (s *Server) HandleGetMeetingInvitesCount(c *fiber.Ctx) error {
 	}
 	return c.JSON(&domain.CountMessage{Count: count})
 }
+
+func (s *Server) HandleGetMeetingInviteHistory(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	mId := c.Params("id")
+
+	i, err := s.inviteService.GetInviteHistoryByMeeting(mId, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.JSON(i)
+}
+
+func (s *Server) HandleGetMeetingVoiceStates(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	mId := c.Params("id")
+
+	vs, err := s.voiceService.GetVoiceStates(mId, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.JSON(vs)
+}
+
+func (s *Server) HandleGetMeetingIceServers(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	mId := c.Params("id")
+
+	is, err := s.iceService.GetIceServers(mId, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.JSON(is)
+}
+
+func (s *Server) HandleRemoveMeetingParticipant(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	mId := c.Params("id")
+	target := c.Params("uid")
+
+	err = s.meetingService.RemoveParticipant(mId, target, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (s *Server) HandleBanMeetingUser(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	mId := c.Params("id")
+	target := c.Params("uid")
+
+	err = s.meetingService.BanUser(mId, target, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (s *Server) HandleUnbanMeetingUser(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	mId := c.Params("id")
+	target := c.Params("uid")
+
+	err = s.meetingService.UnbanUser(mId, target, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (s *Server) HandleModerateVoiceState(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	mId := c.Params("id")
+	target := c.Params("uid")
+	var dto domain.ModerateVoiceStateDto
+	err = c.BodyParser(&dto)
+	if err != nil {
+		return s.BadRequest(c)
+	}
+
+	vs, err := s.voiceService.ModerateVoiceState(mId, target, uid, &dto)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.JSON(vs)
+}
+
+func (s *Server) HandlePromoteMeetingOrganizer(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	mId := c.Params("id")
+	target := c.Params("uid")
+
+	err = s.meetingService.PromoteOrganizer(mId, target, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (s *Server) HandleDemoteMeetingOrganizer(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	mId := c.Params("id")
+	target := c.Params("uid")
+
+	err = s.meetingService.DemoteOrganizer(mId, target, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (s *Server) HandleTransferMeetingOwnership(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+	mId := c.Params("id")
+	var dto domain.TransferOwnershipDto
+	err = c.BodyParser(&dto)
+	if err != nil || dto.OwnerID == "" {
+		return s.BadRequest(c)
+	}
+
+	err = s.meetingService.TransferOwnership(mId, &dto, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
@@ -19,8 +19,12 @@
 package web
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
 	"github.com/gofiber/fiber/v2"
 	"github.com/hearky/server/pkg/domain"
+	"sort"
 )
 
 func (s *Server) HandleCreateUser(c *fiber.Ctx) error {
@@ -70,6 +74,93 @@ func (s *Server) HandleDeleteMe(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusOK)
 }
 
+func (s *Server) HandleUpdateMySettings(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+
+	var dto domain.UpdateUserSettingsDto
+	err = c.BodyParser(&dto)
+	if err != nil {
+		return s.BadRequest(c)
+	}
+
+	u, err := s.userService.UpdateSettings(&dto, uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+
+	return c.JSON(u)
+}
+
+func (s *Server) HandleExportMe(c *fiber.Ctx) error {
+	uid, err := s.Authorize(c)
+	if err != nil || uid == "" {
+		return nil
+	}
+
+	e, err := s.userService.ExportUser(uid)
+	if err != nil {
+		return s.DomainError(c, err)
+	}
+
+	switch c.Query("format", "json") {
+	case "json":
+		c.Attachment("hearky-export.json")
+		return c.JSON(e)
+	case "zip":
+		b, err := exportArchive(e)
+		if err != nil {
+			return s.InternalError(c)
+		}
+		c.Attachment("hearky-export.zip")
+		return c.Send(b)
+	}
+	return s.BadRequest(c)
+}
+
+// exportArchive creates a ZIP archive containing a JSON file for every part of the export
+func exportArchive(e *domain.UserExport) ([]byte, error) {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	var parts map[string]json.RawMessage
+	err = json.Unmarshal(raw, &parts)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(parts))
+	for n := range parts {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, n := range names {
+		f, err := w.Create(n + ".json")
+		if err != nil {
+			return nil, err
+		}
+		var pretty bytes.Buffer
+		err = json.Indent(&pretty, parts[n], "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		_, err = f.Write(pretty.Bytes())
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 func (s *Server) HandleGetMyMeetings(c *fiber.Ctx) error {
 	uid, err := s.Authorize(c)
 	if err != nil || uid == "" {
@@ -19,32 +19,45 @@
 package web
 
 import (
-	"firebase.google.com/go/v4/auth"
 	"github.com/ansrivas/fiberprometheus/v2"
 	"github.com/getsentry/sentry-go"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/monitor"
+	"github.com/gofiber/websocket/v2"
+	"github.com/hearky/server/pkg/api"
 	"github.com/hearky/server/pkg/domain"
 	"go.uber.org/zap"
 )
 
 type Server struct {
 	app            *fiber.App
-	fbAuth         *auth.Client
+	auth           domain.Authenticator
 	userService    domain.UserService
 	meetingService domain.MeetingService
 	inviteService  domain.InviteService
+	voiceService   domain.VoiceService
+	iceService     domain.IceService
+	friendService  domain.FriendService
+	blockService   domain.BlockService
+	adminService   domain.AdminService
+	gateway        *api.Gateway
 }
 
-func New(dev bool, fbAuth *auth.Client, userService domain.UserService, meetingService domain.MeetingService, inviteService domain.InviteService) *Server {
+func New(dev bool, auth domain.Authenticator, userService domain.UserService, meetingService domain.MeetingService, inviteService domain.InviteService, voiceService domain.VoiceService, iceService domain.IceService, friendService domain.FriendService, blockService domain.BlockService, adminService domain.AdminService, gateway *api.Gateway) *Server {
 	app := fiber.New()
 
 	s := &Server{
 		app:            app,
-		fbAuth:         fbAuth,
+		auth:           auth,
 		userService:    userService,
 		meetingService: meetingService,
 		inviteService:  inviteService,
+		voiceService:   voiceService,
+		iceService:     iceService,
+		friendService:  friendService,
+		blockService:   blockService,
+		adminService:   adminService,
+		gateway:        gateway,
 	}
 
 	// Register metrics endpoint for prometheus scraping
@@ -55,28 +68,77 @@ func New(dev bool, fbAuth *auth.Client, userService domain.UserService, meetingS
 	// Monitoring Dashboard
 	app.Get("/dashboard", monitor.New())
 
+	// Register WebSocket gateway
+	app.Use("/gateway", s.HandleUpgrade)
+	app.Get("/gateway", websocket.New(gateway.Handle))
+
 	// Register API routes
 	api := app.Group("/api")
 	api.Post("/meetings", s.HandleCreateMeeting)
 	api.Get("/meetings/:id", s.HandleGetMeetingByID)
+	api.Patch("/meetings/:id", s.HandleUpdateMeeting)
 	api.Delete("/meetings/:id", s.HandleDeleteMeeting)
+	api.Post("/meetings/:id/leave", s.HandleLeaveMeeting)
 	api.Get("/meetings/:id/invites", s.HandleGetMeetingInvites)
 	api.Get("/meetings/:id/invites/count", s.HandleGetMeetingInvitesCount)
+	api.Get("/meetings/:id/invites/history", s.HandleGetMeetingInviteHistory)
+	api.Get("/meetings/:id/voice", s.HandleGetMeetingVoiceStates)
+	api.Patch("/meetings/:id/voice/:uid", s.HandleModerateVoiceState)
+	api.Delete("/meetings/:id/participants/:uid", s.HandleRemoveMeetingParticipant)
+	api.Put("/meetings/:id/bans/:uid", s.HandleBanMeetingUser)
+	api.Delete("/meetings/:id/bans/:uid", s.HandleUnbanMeetingUser)
+	api.Put("/meetings/:id/organizers/:uid", s.HandlePromoteMeetingOrganizer)
+	api.Delete("/meetings/:id/organizers/:uid", s.HandleDemoteMeetingOrganizer)
+	api.Post("/meetings/:id/transfer", s.HandleTransferMeetingOwnership)
+	api.Get("/meetings/:id/ice-servers", s.HandleGetMeetingIceServers)
 
 	api.Post("/users", s.HandleCreateUser)
 	api.Get("/users/@me", s.HandleGetMe)
 	api.Delete("/users/@me", s.HandleDeleteMe)
+	api.Get("/users/@me/export", s.HandleExportMe)
 	api.Get("/users/@me/meetings", s.HandleGetMyMeetings)
 	api.Get("/users/@me/meetings/count", s.HandleGetMyMeetingsCount)
 	api.Get("/users/@me/invites", s.HandleGetMyInvites)
 	api.Get("/users/@me/invites/count", s.HandleGetMyInvitesCount)
+	api.Patch("/users/@me/settings", s.HandleUpdateMySettings)
+	api.Get("/users/@me/friends", s.HandleGetMyFriends)
+	api.Delete("/users/@me/friends/:uid", s.HandleRemoveFriend)
+	api.Get("/users/@me/friends/requests", s.HandleGetMyFriendRequests)
+	api.Post("/users/@me/friends/requests", s.HandleSendFriendRequest)
+	api.Post("/users/@me/friends/requests/:uid/accept", s.HandleAcceptFriendRequest)
+	api.Post("/users/@me/friends/requests/:uid/decline", s.HandleDeclineFriendRequest)
+	api.Get("/users/@me/blocks", s.HandleGetMyBlocks)
+	api.Put("/users/@me/blocks/:uid", s.HandleBlockUser)
+	api.Delete("/users/@me/blocks/:uid", s.HandleUnblockUser)
 
 	api.Post("/invites", s.HandleSendInvite)
+	api.Post("/invites/bulk", s.HandleSendInvites)
 	api.Post("/invites/:id/accept", s.HandleAcceptInvite)
-	api.Delete("/invites/:id", s.HandleDeleteInvite)
+	api.Post("/invites/:id/decline", s.HandleDeclineInvite)
+	api.Delete("/invites/:id", s.HandleRevokeInvite)
+
+	// Register admin routes, the services check the permissions of the user
+	admin := api.Group("/admin")
+	admin.Get("/users", s.HandleAdminGetUsers)
+	admin.Get("/users/:id", s.HandleAdminGetUser)
+	admin.Get("/users/:id/meetings", s.HandleAdminGetUserMeetings)
+	admin.Get("/users/:id/invites", s.HandleAdminGetUserInvites)
+	admin.Post("/users/:id/username/reset", s.HandleAdminResetUsername)
+	admin.Patch("/users/:id/upgrade", s.HandleAdminUpdateUserUpgrade)
+	admin.Delete("/meetings/:id", s.HandleAdminDeleteMeeting)
+	admin.Patch("/meetings/:id/upgrade", s.HandleAdminUpdateMeetingUpgrade)
+	admin.Get("/audit", s.HandleAdminGetAuditLog)
 	return s
 }
 
+// HandleUpgrade rejects requests to the gateway which are not WebSocket upgrades
+func (s *Server) HandleUpgrade(c *fiber.Ctx) error {
+	if websocket.IsWebSocketUpgrade(c) {
+		return c.Next()
+	}
+	return fiber.ErrUpgradeRequired
+}
+
 func (s *Server) Start(addr string) {
 	err := s.app.Listen(addr)
 	if err != nil {